@@ -1,62 +1,84 @@
 package config
 
 import (
-	"log/slog"
+	"errors"
 
 	"github.com/rs/zerolog/log"
-
-	"github.com/spf13/viper"
 )
 
+// Config - Settings shared by every service. Services embed it in their own
+// config struct, which Load fills the same way:
+//
+//	type ApiConfig struct {
+//		config.Config
+//		UPLOAD_BUCKET string `env:"UPLOAD_BUCKET" required:"true"`
+//	}
 type Config struct {
-	APP_NAME                   string `mapstructure:"app_name"`
-	APP_ENV                    string `mapstructure:"app_env"`
-	APP_KEY                    string `mapstructure:"app_key"`
-	DB_URL                     string `mapstructure:"db_url"`
-	PORT                       int    `mapstructure:"port"`
-	DISABLE_GRAPHQL_PLAYGROUND bool   `mapstructure:"disable_graphql_playground"`
+	APP_NAME                   string          `mapstructure:"app_name" env:"APP_NAME" required:"true"`
+	APP_ENV                    Environment     `mapstructure:"app_env" env:"APP_ENV" default:"development" validate:"oneof=development testing staging production"`
+	APP_KEY                    string          `mapstructure:"app_key" env:"APP_KEY" secret:"true"`
+	DB_URL                     string          `mapstructure:"db_url" env:"DB_URL" validate:"dsn" secret:"true"`
+	DB_REPLICA_URLS            []string        `mapstructure:"db_replica_urls" env:"DB_REPLICA_URLS" secret:"true"`
+	DB_RUN_MIGRATIONS          bool            `mapstructure:"db_run_migrations" env:"DB_RUN_MIGRATIONS"`
+	PORT                       int             `mapstructure:"port" env:"PORT" validate:"min=1,max=65535"`
+	DISABLE_GRAPHQL_PLAYGROUND bool            `mapstructure:"disable_graphql_playground" env:"DISABLE_GRAPHQL_PLAYGROUND"`
+	LOG                        LogConfig       `mapstructure:"log" env:"LOG"`
+	JWT                        JwtConfig       `mapstructure:"jwt" env:"JWT"`
+	HTTP                       HttpConfig      `mapstructure:"http" env:"HTTP"`
+	DB                         DbConfig        `mapstructure:"db" env:"DB"`
+	TELEMETRY                  TelemetryConfig `mapstructure:"telemetry" env:"TELEMETRY"`
 }
 
+// New - Loads Config from the .env files and the environment, see LoadOpts,
+// logging what is invalid. It panics rather than return a config breaking
+// Guardrails, or one whose APP_ENV is invalid so Guardrails cannot tell
+// whether it is production. Prefer Load, which returns the problems instead.
 func New() *Config {
-	config := Config{}
-
-	viper.AddConfigPath(".")
-	viper.SetConfigFile(".env.yml")
-	viper.AutomaticEnv()
-
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			slog.Warn("failed to read config file")
-		}
+	config, _, err := load[Config](LoadOpts{})
+	if err != nil {
+		log.Err(err).Msg("invalid config")
 	}
 
-	if err := viper.BindEnv("APP_NAME"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
+	if config == nil {
+		config = &Config{}
 	}
 
-	if err := viper.BindEnv("APP_ENV"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
+	if invalidKey(err, "APP_ENV") {
+		log.Panic().Err(err).Msg("refusing to start without a valid APP_ENV")
 	}
 
-	if err := viper.BindEnv("APP_KEY"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
+	if err := config.Guardrails(); err != nil {
+		log.Panic().Err(err).Msg("refusing to start with an unsafe production config")
 	}
 
-	if err := viper.BindEnv("DB_URL"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
-	}
+	return config
+}
 
-	if err := viper.BindEnv("PORT"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
+// invalidKey - Whether err, as returned by Load, rejects the value of key
+func invalidKey(err error, key string) bool {
+	var problems Errors
+	if !errors.As(err, &problems) {
+		return false
 	}
 
-	if err := viper.BindEnv("JWT_SECRET"); err != nil {
-		log.Err(err).Msg("failed to bind environment variable")
+	for _, problem := range problems {
+		if problem.Key == key {
+			return true
+		}
 	}
 
-	if err := viper.Unmarshal(&config); err != nil {
-		log.Err(err).Msg("unable to parse config file")
-	}
+	return false
+}
 
-	return &config
+// Redacted - Copy safe to log or serve, see Redact
+func (c *Config) Redacted() *Config {
+	return Redact(c)
+}
+
+// ServiceName - TELEMETRY_SERVICE_NAME, else APP_NAME
+func (c *Config) ServiceName() string {
+	if c.TELEMETRY.SERVICE_NAME != "" {
+		return c.TELEMETRY.SERVICE_NAME
+	}
+	return c.APP_NAME
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,5 +11,34 @@ func TestNew(t *testing.T) {
 	conf := New()
 
 	assert.NotEmpty(t, conf.APP_NAME)
-	assert.Equal(t, conf.APP_ENV, "testing")
+	assert.Equal(t, ENV_TESTING, conf.APP_ENV)
+	assert.True(t, conf.APP_ENV.IsTesting())
+	assert.False(t, conf.APP_ENV.IsProduction())
+}
+
+func TestNewRefusesUnsafeProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("APP_KEY", "")
+
+	assert.Panics(t, func() { New() })
+}
+
+func TestNewRefusesInvalidAppEnv(t *testing.T) {
+	t.Setenv("APP_ENV", "prod")
+
+	assert.Panics(t, func() { New() })
+}
+
+func TestNewToleratesOtherProblemsInProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("APP_KEY", strings.Repeat("k", MIN_SECRET_LENGTH)+"a")
+	t.Setenv("JWT_SECRET", strings.Repeat("j", MIN_SECRET_LENGTH)+"a")
+	t.Setenv("DISABLE_GRAPHQL_PLAYGROUND", "true")
+	t.Setenv("DB_URL", "postgres://app@db/app?sslmode=require")
+	t.Setenv("PORT", "not-a-port")
+
+	var conf *Config
+	assert.NotPanics(t, func() { conf = New() })
+	assert.True(t, conf.APP_ENV.IsProduction())
+	assert.Zero(t, conf.PORT)
 }
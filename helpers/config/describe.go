@@ -0,0 +1,232 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// REDACTED replaces secret values. URLs carrying a password keep their shape
+// with the password and query values masked, see redactValue.
+const REDACTED = "[REDACTED]"
+
+// URL_MASK is what url.URL.Redacted puts in place of a password
+const URL_MASK = "xxxxx"
+
+// PUBLIC_QUERY_KEYS - Query parameters of a connection URL whose value is
+// never a credential, every other value is masked
+var PUBLIC_QUERY_KEYS = map[string]bool{
+	"sslmode":              true,
+	"connect_timeout":      true,
+	"application_name":     true,
+	"target_session_attrs": true,
+}
+
+// KeyDescription - One key of a config, as listed by Describe
+type KeyDescription struct {
+	Key      string `json:"key"`
+	FileKey  string `json:"file_key"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Source   string `json:"source"`
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required"`
+	Secret   bool   `json:"secret"`
+	Validate string `json:"validate,omitempty"`
+}
+
+type Description []KeyDescription
+
+// Redact - Copy of config with every field tagged secret masked. URLs with a
+// password keep their host so it can still be checked, see redactValue.
+func Redact[T any](config *T) *T {
+	redacted := new(T)
+	*redacted = *config
+
+	fields, err := fieldsOf(redacted)
+	if err != nil {
+		return redacted
+	}
+
+	for _, f := range fields {
+		if !f.Secret {
+			continue
+		}
+
+		switch value := f.value.Interface().(type) {
+		case string:
+			f.value.SetString(redactValue(value))
+		case []string:
+			masked := make([]string, len(value))
+			for i, item := range value {
+				masked[i] = redactValue(item)
+			}
+			f.value.Set(reflect.ValueOf(masked))
+		default:
+			f.value.Set(reflect.Zero(f.value.Type()))
+		}
+	}
+
+	return redacted
+}
+
+// redactValue - REDACTED, unless value is a URL with a password in its
+// userinfo. Such a URL keeps its host and path but loses the password and
+// every query value outside PUBLIC_QUERY_KEYS. A URL without a password is
+// masked whole, its credentials may sit in the path or query instead, as in
+// postgres://db/app?password=... or a webhook token.
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return REDACTED
+	}
+
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return REDACTED
+	}
+
+	query := u.Query()
+	for key := range query {
+		if !PUBLIC_QUERY_KEYS[strings.ToLower(key)] {
+			query[key] = []string{URL_MASK}
+		}
+	}
+
+	masked := *u
+	masked.User = url.UserPassword(u.User.Username(), URL_MASK)
+	masked.RawQuery = query.Encode()
+
+	return masked.String()
+}
+
+// Describe - Loads T and describes every key, also when some are invalid,
+// which is when the description is needed most
+func Describe[T any](opts LoadOpts) (Description, error) {
+	config, sources, err := load[T](opts)
+	if config == nil {
+		return nil, err
+	}
+
+	return DescribeWith(config, sources), err
+}
+
+// DescribeWith - Describes an already loaded config, e.g. Watcher.Current
+// with Watcher.Sources
+func DescribeWith[T any](config *T, sources Sources) Description {
+	fields, err := fieldsOf(Redact(config))
+	if err != nil {
+		return nil
+	}
+
+	description := make(Description, 0, len(fields))
+
+	for _, f := range fields {
+		source := sources[f.Env]
+		if source.Kind == "" {
+			source.Kind = SOURCE_UNSET
+		}
+
+		description = append(description, KeyDescription{
+			Key:      f.Env,
+			FileKey:  f.Key,
+			Type:     f.value.Type().String(),
+			Value:    formatValue(f.value),
+			Source:   source.String(),
+			Default:  f.Default,
+			Required: f.Required,
+			Secret:   f.Secret,
+			Validate: f.Validate,
+		})
+	}
+
+	return description
+}
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+// Text - Aligned table, one key per line
+func (d Description) Text() string {
+	buf := &strings.Builder{}
+	tw := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "KEY\tTYPE\tVALUE\tSOURCE\tDEFAULT\tREQUIRED")
+	for _, key := range d {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\n", key.Key, key.Type, key.Value, key.Source, key.Default, key.Required)
+	}
+
+	tw.Flush()
+
+	return buf.String()
+}
+
+func (d Description) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// EnvExample - A .env.example listing every key with its default and a
+// comment on what it accepts. Values are never included.
+func (d Description) EnvExample() string {
+	buf := &strings.Builder{}
+
+	for i, key := range d {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		notes := []string{key.Type}
+		if key.Required {
+			notes = append(notes, "required")
+		}
+		if key.Secret {
+			notes = append(notes, "secret")
+		}
+		if key.Validate != "" {
+			notes = append(notes, key.Validate)
+		}
+
+		fmt.Fprintf(buf, "# %s\n%s=%s\n", strings.Join(notes, ", "), key.Key, key.Default)
+	}
+
+	return buf.String()
+}
+
+// DiagnosticsHandler - Serves describe as JSON, or as text with ?format=text.
+// Mount it behind authentication, keys and sources are still revealing.
+func DiagnosticsHandler(describe func() Description) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		description := describe()
+
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, description.Text())
+			return
+		}
+
+		body, err := description.JSON()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
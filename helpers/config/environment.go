@@ -0,0 +1,129 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Environment - APP_ENV, one of the ENV_ constants
+type Environment string
+
+const (
+	ENV_DEVELOPMENT Environment = "development"
+	ENV_TESTING     Environment = "testing"
+	ENV_STAGING     Environment = "staging"
+	ENV_PRODUCTION  Environment = "production"
+
+	// MIN_SECRET_LENGTH is the number of bytes APP_KEY and JWT_SECRET need in
+	// production, after decoding base64: keys
+	MIN_SECRET_LENGTH = 32
+
+	BASE64_KEY_PREFIX = "base64:"
+)
+
+var (
+	ErrPlaygroundEnabled = errors.New("must be true in production, the GraphQL playground exposes the schema")
+	ErrWeakSecret        = fmt.Errorf("must be set and at least %d random bytes in production", MIN_SECRET_LENGTH)
+	ErrInsecureDatabase  = errors.New("must not use sslmode=disable in production")
+)
+
+func (e Environment) IsDevelopment() bool {
+	return e == ENV_DEVELOPMENT
+}
+
+func (e Environment) IsTesting() bool {
+	return e == ENV_TESTING
+}
+
+func (e Environment) IsStaging() bool {
+	return e == ENV_STAGING
+}
+
+func (e Environment) IsProduction() bool {
+	return e == ENV_PRODUCTION
+}
+
+// Guardrails - Rules of the production environment, every unsafe setting is
+// reported at once. Load enforces them also when Config is embedded in a
+// config with a Validate of its own.
+func (c *Config) Guardrails() error {
+	if !c.APP_ENV.IsProduction() {
+		return nil
+	}
+
+	var problems Errors
+
+	if !c.DISABLE_GRAPHQL_PLAYGROUND {
+		problems = append(problems, &FieldError{Key: "DISABLE_GRAPHQL_PLAYGROUND", Err: ErrPlaygroundEnabled})
+	}
+
+	if weakSecret(c.APP_KEY) {
+		problems = append(problems, &FieldError{Key: "APP_KEY", Err: ErrWeakSecret})
+	}
+
+	if weakSecret(c.JWT.SECRET) {
+		problems = append(problems, &FieldError{Key: "JWT_SECRET", Err: ErrWeakSecret})
+	}
+
+	if sslDisabled(c.DB_URL) {
+		problems = append(problems, &FieldError{Key: "DB_URL", Err: ErrInsecureDatabase})
+	}
+
+	for _, replica := range c.DB_REPLICA_URLS {
+		if sslDisabled(replica) {
+			problems = append(problems, &FieldError{Key: "DB_REPLICA_URLS", Err: ErrInsecureDatabase})
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+// weakSecret - Missing, shorter than MIN_SECRET_LENGTH or a single repeated
+// character such as a placeholder of zeros
+func weakSecret(secret string) bool {
+	key := []byte(secret)
+
+	if encoded, ok := strings.CutPrefix(secret, BASE64_KEY_PREFIX); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return true
+		}
+		key = decoded
+	}
+
+	if len(key) < MIN_SECRET_LENGTH {
+		return true
+	}
+
+	for _, b := range key[1:] {
+		if b != key[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sslDisabled - Whether a postgres URL or key=value connection string turns
+// TLS off
+func sslDisabled(dsn string) bool {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Query().Get("sslmode") == "disable"
+	}
+
+	for _, pair := range strings.Fields(dsn) {
+		if key, value, _ := strings.Cut(pair, "="); key == "sslmode" {
+			return strings.Trim(value, "'") == "disable"
+		}
+	}
+
+	return false
+}
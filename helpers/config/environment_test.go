@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func productionOverrides() map[string]any {
+	return map[string]any{
+		"APP_NAME":                   "api",
+		"APP_ENV":                    "production",
+		"APP_KEY":                    "base64:nsv6mG4ZB7Ao0tQw1AjYQzvXoKkTzwlv9J1ZSu1TXi8=",
+		"JWT_SECRET":                 "f3a1c9d2e8b74a6f9c0d1e2f3a4b5c6d",
+		"DB_URL":                     "postgres://app:s3cret@db:5432/app?sslmode=verify-full",
+		"DISABLE_GRAPHQL_PLAYGROUND": true,
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	assert.True(t, ENV_PRODUCTION.IsProduction())
+	assert.True(t, ENV_STAGING.IsStaging())
+	assert.True(t, ENV_DEVELOPMENT.IsDevelopment())
+	assert.False(t, ENV_TESTING.IsProduction())
+	assert.False(t, Environment("").IsDevelopment())
+}
+
+func TestProductionGuardrails(t *testing.T) {
+	config, err := Load[Config](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: productionOverrides()})
+	assert.Nil(t, err)
+	assert.True(t, config.APP_ENV.IsProduction())
+
+	cases := []struct {
+		name    string
+		key     string
+		value   any
+		wantErr error
+	}{
+		{"Playground enabled", "DISABLE_GRAPHQL_PLAYGROUND", false, ErrPlaygroundEnabled},
+		{"Missing app key", "APP_KEY", "", ErrWeakSecret},
+		{"Short jwt secret", "JWT_SECRET", "secret", ErrWeakSecret},
+		{"Repeated jwt secret", "JWT_SECRET", strings.Repeat("0", 64), ErrWeakSecret},
+		{"Short base64 app key", "APP_KEY", "base64:c2VjcmV0", ErrWeakSecret},
+		{"Database without tls", "DB_URL", "postgres://app:s3cret@db:5432/app?sslmode=disable", ErrInsecureDatabase},
+		{"Connection string without tls", "DB_URL", "host=db dbname=app sslmode=disable", ErrInsecureDatabase},
+		{"Replica without tls", "DB_REPLICA_URLS", "postgres://replica/app,postgres://replica-2/app?sslmode=disable", ErrInsecureDatabase},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			overrides := productionOverrides()
+			overrides[c.key] = c.value
+
+			_, err := Load[Config](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: overrides})
+			assert.ErrorIs(t, err, c.wantErr)
+
+			var problems Errors
+			assert.True(t, errors.As(err, &problems))
+			assert.Len(t, problems, 1)
+			assert.Equal(t, c.key, problems[0].Key)
+		})
+	}
+
+	t.Run("Connection strings are accepted", func(t *testing.T) {
+		overrides := productionOverrides()
+		overrides["DB_URL"] = "host=db dbname=app password='s3 cret' sslmode=verify-full"
+
+		config, err := Load[Config](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: overrides})
+		assert.Nil(t, err)
+		assert.Equal(t, overrides["DB_URL"], config.DB_URL)
+	})
+
+	t.Run("Other environments are not guarded", func(t *testing.T) {
+		_, err := Load[Config](LoadOpts{
+			SearchPaths: []string{t.TempDir()},
+			Overrides:   map[string]any{"APP_NAME": "api", "APP_ENV": "staging", "DB_URL": "postgres://db/app?sslmode=disable"},
+		})
+		assert.Nil(t, err)
+	})
+}
+
+type embeddingTestConfig struct {
+	Config
+	UPLOAD_BUCKET string `env:"EMBEDDING_TEST_UPLOAD_BUCKET" default:"uploads"`
+}
+
+// Validate - Shadows the one promoted from Config, which must not switch
+// the guardrails off
+func (c *embeddingTestConfig) Validate() error {
+	if c.UPLOAD_BUCKET == "" {
+		return &FieldError{Key: "EMBEDDING_TEST_UPLOAD_BUCKET", Err: ErrRequired}
+	}
+	return nil
+}
+
+type promotingTestConfig struct {
+	Config
+}
+
+func TestGuardrailsWhenEmbedded(t *testing.T) {
+	overrides := productionOverrides()
+	overrides["APP_KEY"] = "short"
+
+	_, err := Load[embeddingTestConfig](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: overrides})
+	assert.ErrorIs(t, err, ErrWeakSecret)
+
+	// Reported once, not again through the promoted method
+	var problems Errors
+	assert.True(t, errors.As(err, &problems))
+	assert.Len(t, problems, 1)
+
+	_, err = Load[promotingTestConfig](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: overrides})
+	assert.True(t, errors.As(err, &problems))
+	assert.Len(t, problems, 1)
+	assert.Equal(t, "APP_KEY", problems[0].Key)
+
+	config, err := Load[embeddingTestConfig](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: productionOverrides()})
+	assert.Nil(t, err)
+	assert.Equal(t, "uploads", config.UPLOAD_BUCKET)
+}
+
+func TestSslDisabled(t *testing.T) {
+	assert.True(t, sslDisabled("postgres://db/app?sslmode=disable"))
+	assert.True(t, sslDisabled("host=db sslmode='disable'"))
+	assert.False(t, sslDisabled("host=db sslmode=require"))
+	assert.False(t, sslDisabled("postgres://db/app"))
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DEFAULT_LOCAL_SUFFIX = "local"
+
+	// CONFIG_PATH_ENV lists the directories config files are searched in,
+	// separated like PATH, when LoadOpts.SearchPaths is empty
+	CONFIG_PATH_ENV = "CONFIG_PATH"
+
+	// PROFILE_ENV picks the profile file, e.g. .env.testing.yml
+	PROFILE_ENV = "APP_ENV"
+)
+
+type SourceKind string
+
+const (
+	SOURCE_UNSET    SourceKind = "unset"
+	SOURCE_DEFAULT  SourceKind = "default"
+	SOURCE_FILE     SourceKind = "file"
+	SOURCE_VIPER    SourceKind = "viper"
+	SOURCE_ENV      SourceKind = "env"
+	SOURCE_OVERRIDE SourceKind = "override"
+)
+
+// Source - Where the effective value of a key came from. Name is the file
+// path for SOURCE_FILE and the variable for SOURCE_ENV.
+type Source struct {
+	Kind SourceKind
+	Name string
+}
+
+func (s Source) String() string {
+	if s.Name == "" {
+		return string(s.Kind)
+	}
+	return string(s.Kind) + " " + s.Name
+}
+
+// Sources - Source of every key, by environment variable name
+type Sources map[string]Source
+
+// layer - One config file that was found, or LoadOpts.Viper
+type layer struct {
+	source Source
+	values *viper.Viper
+}
+
+// readLayers - The base file, the profile file and the local override file,
+// each taken from the first search path that has it, then LoadOpts.Viper.
+// Lowest precedence first.
+func readLayers(opts LoadOpts) ([]layer, string, error) {
+	layers := []layer{}
+
+	base, err := readLayer(opts.SearchPaths, opts.ConfigFile)
+	if err != nil {
+		return nil, "", err
+	}
+	if base != nil {
+		layers = append(layers, *base)
+	}
+
+	var injected []layer
+	if opts.Viper != nil {
+		injected = append(injected, layer{source: Source{Kind: SOURCE_VIPER}, values: opts.Viper})
+	}
+
+	profile := opts.profile(append(layers, injected...))
+	if profile != "" {
+		profileLayer, err := readLayer(opts.SearchPaths, withSuffix(opts.ConfigFile, profile))
+		if err != nil {
+			return nil, "", err
+		}
+		if profileLayer != nil {
+			layers = append(layers, *profileLayer)
+		}
+	}
+
+	local, err := readLayer(opts.SearchPaths, opts.LocalFile)
+	if err != nil {
+		return nil, "", err
+	}
+	if local != nil {
+		layers = append(layers, *local)
+	}
+
+	return append(layers, injected...), profile, nil
+}
+
+func readLayer(searchPaths []string, name string) (*layer, error) {
+	for _, path := range candidates(searchPaths, name) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		values := viper.New()
+		values.SetConfigFile(path)
+		if err := values.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		return &layer{source: Source{Kind: SOURCE_FILE, Name: path}, values: values}, nil
+	}
+
+	return nil, nil
+}
+
+func candidates(searchPaths []string, name string) []string {
+	if filepath.IsAbs(name) {
+		return []string{name}
+	}
+
+	paths := make([]string, 0, len(searchPaths))
+	for _, dir := range searchPaths {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
+
+// withSuffix - .env.yml with suffix testing is .env.testing.yml
+func withSuffix(file string, suffix string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + suffix + ext
+}
+
+// profile - LoadOpts.Profile, else APP_ENV from the overrides, the
+// environment, LoadOpts.Viper or the base file, in that order
+func (o LoadOpts) profile(layers []layer) string {
+	if o.Profile != "" {
+		return o.Profile
+	}
+
+	if value, ok := o.Overrides[PROFILE_ENV]; ok {
+		return fmt.Sprint(value)
+	}
+
+	if value := os.Getenv(PROFILE_ENV); value != "" {
+		return value
+	}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		if value := layers[i].values.GetString(strings.ToLower(PROFILE_ENV)); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// lookup - Effective raw value of f and where it came from, highest
+// precedence first: overrides, environment, LoadOpts.Viper, local file,
+// profile file, base file and the default
+func (o LoadOpts) lookup(f field, layers []layer) (any, Source) {
+	if value, ok := o.Overrides[f.Env]; ok {
+		return value, Source{Kind: SOURCE_OVERRIDE}
+	}
+
+	if value, ok := os.LookupEnv(f.Env); ok && (value != "" || o.AllowEmptyEnv) {
+		return value, Source{Kind: SOURCE_ENV, Name: f.Env}
+	}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		if layers[i].values.IsSet(f.Key) {
+			return layers[i].values.Get(f.Key), layers[i].source
+		}
+	}
+
+	if f.HasDefault {
+		return f.Default, Source{Kind: SOURCE_DEFAULT}
+	}
+
+	return nil, Source{Kind: SOURCE_UNSET}
+}
+
+func defaultSearchPaths() []string {
+	if paths := os.Getenv(CONFIG_PATH_ENV); paths != "" {
+		return filepath.SplitList(paths)
+	}
+	return []string{"."}
+}
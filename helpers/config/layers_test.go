@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type layersTestConfig struct {
+	AppEnv  string `env:"APP_ENV"`
+	Name    string `env:"LAYERS_TEST_NAME" default:"default-name"`
+	Host    string `env:"LAYERS_TEST_HOST"`
+	Port    int    `env:"LAYERS_TEST_PORT"`
+	Debug   bool   `env:"LAYERS_TEST_DEBUG"`
+	Region  string `env:"LAYERS_TEST_REGION"`
+	Missing string `env:"LAYERS_TEST_MISSING"`
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600))
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env.yml":         "app_env: testing\nlayers_test_host: base\nlayers_test_port: 1000\nlayers_test_debug: false\nlayers_test_region: eu\n",
+		".env.testing.yml": "layers_test_host: profile\nlayers_test_port: 2000\n",
+		".env.local.yml":   "layers_test_port: 3000\n",
+	})
+
+	// Restored by t.Setenv, unset so the base file picks the profile
+	t.Setenv("APP_ENV", "")
+	os.Unsetenv("APP_ENV")
+	t.Setenv("LAYERS_TEST_DEBUG", "true")
+
+	config, sources, err := LoadWithSources[layersTestConfig](LoadOpts{
+		SearchPaths: []string{dir},
+		Overrides:   map[string]any{"LAYERS_TEST_REGION": "us"},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "default-name", config.Name)
+	assert.Equal(t, "profile", config.Host)
+	assert.Equal(t, 3000, config.Port)
+	assert.True(t, config.Debug)
+	assert.Equal(t, "us", config.Region)
+
+	assert.Equal(t, Source{Kind: SOURCE_DEFAULT}, sources["LAYERS_TEST_NAME"])
+	assert.Equal(t, Source{Kind: SOURCE_FILE, Name: filepath.Join(dir, ".env.yml")}, sources["APP_ENV"])
+	assert.Equal(t, Source{Kind: SOURCE_FILE, Name: filepath.Join(dir, ".env.testing.yml")}, sources["LAYERS_TEST_HOST"])
+	assert.Equal(t, Source{Kind: SOURCE_FILE, Name: filepath.Join(dir, ".env.local.yml")}, sources["LAYERS_TEST_PORT"])
+	assert.Equal(t, Source{Kind: SOURCE_ENV, Name: "LAYERS_TEST_DEBUG"}, sources["LAYERS_TEST_DEBUG"])
+	assert.Equal(t, Source{Kind: SOURCE_OVERRIDE}, sources["LAYERS_TEST_REGION"])
+	assert.Equal(t, Source{Kind: SOURCE_UNSET}, sources["LAYERS_TEST_MISSING"])
+
+	assert.Equal(t, "env LAYERS_TEST_DEBUG", sources["LAYERS_TEST_DEBUG"].String())
+	assert.Equal(t, "override", sources["LAYERS_TEST_REGION"].String())
+}
+
+func TestLoadEmptyEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".env.yml": "layers_test_host: from-file\n"})
+
+	// What compose passes on for HOST: ${HOST} when the host has no HOST
+	t.Setenv("APP_ENV", "")
+	t.Setenv("LAYERS_TEST_HOST", "")
+	t.Setenv("LAYERS_TEST_NAME", "")
+
+	config, sources, err := LoadWithSources[layersTestConfig](LoadOpts{SearchPaths: []string{dir}})
+	assert.Nil(t, err)
+	assert.Equal(t, "from-file", config.Host)
+	assert.Equal(t, "default-name", config.Name)
+	assert.Equal(t, SOURCE_FILE, sources["LAYERS_TEST_HOST"].Kind)
+	assert.Equal(t, Source{Kind: SOURCE_DEFAULT}, sources["LAYERS_TEST_NAME"])
+
+	config, sources, err = LoadWithSources[layersTestConfig](LoadOpts{SearchPaths: []string{dir}, AllowEmptyEnv: true})
+	assert.Nil(t, err)
+	assert.Empty(t, config.Host)
+	assert.Equal(t, Source{Kind: SOURCE_ENV, Name: "LAYERS_TEST_HOST"}, sources["LAYERS_TEST_HOST"])
+
+	t.Run("Typed config falls back to the default APP_ENV", func(t *testing.T) {
+		config, err := Load[Config](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: map[string]any{"APP_NAME": "api"}})
+		assert.Nil(t, err)
+		assert.Equal(t, ENV_DEVELOPMENT, config.APP_ENV)
+	})
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".env.yml":            "app_env: testing\nlayers_test_host: base\n",
+		".env.testing.yml":    "layers_test_host: testing\n",
+		".env.staging.yml":    "layers_test_host: staging\n",
+		".env.production.yml": "layers_test_host: production\n",
+	})
+
+	opts := LoadOpts{SearchPaths: []string{dir}}
+
+	t.Setenv("APP_ENV", "staging")
+	config, err := Load[layersTestConfig](opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "staging", config.Host)
+
+	opts.Overrides = map[string]any{"APP_ENV": "production"}
+	config, err = Load[layersTestConfig](opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "production", config.Host)
+
+	opts.Profile = "testing"
+	config, err = Load[layersTestConfig](opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "testing", config.Host)
+}
+
+func TestLoadSearchPaths(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+
+	writeFiles(t, first, map[string]string{".env.local.yml": "layers_test_port: 1\n"})
+	writeFiles(t, second, map[string]string{
+		".env.yml":       "layers_test_host: second\n",
+		".env.local.yml": "layers_test_port: 2\n",
+	})
+
+	t.Setenv(CONFIG_PATH_ENV, first+string(os.PathListSeparator)+second)
+	t.Setenv("APP_ENV", "")
+
+	config, err := Load[layersTestConfig](LoadOpts{})
+	assert.Nil(t, err)
+
+	// Each file is taken from the first path having it
+	assert.Equal(t, "second", config.Host)
+	assert.Equal(t, 1, config.Port)
+}
+
+func TestWithSuffix(t *testing.T) {
+	assert.Equal(t, ".env.testing.yml", withSuffix(".env.yml", "testing"))
+	assert.Equal(t, "config/app.local.yaml", withSuffix("config/app.yaml", "local"))
+}
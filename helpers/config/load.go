@@ -0,0 +1,338 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+const (
+	DEFAULT_CONFIG_FILE = ".env.yml"
+
+	TAG_ENV      = "env"
+	TAG_DEFAULT  = "default"
+	TAG_REQUIRED = "required"
+	TAG_VALIDATE = "validate"
+	TAG_SECRET   = "secret"
+	TAG_FILE_KEY = "mapstructure"
+)
+
+// LoadOpts - Values are layered, each overriding the ones before: tag
+// defaults, ConfigFile, its profile variant such as .env.testing.yml,
+// LocalFile, the environment and Overrides. Missing files are skipped.
+type LoadOpts struct {
+	// ConfigFile defaults to DEFAULT_CONFIG_FILE
+	ConfigFile string
+	// LocalFile holds uncommitted machine specific values, defaults to
+	// ConfigFile with DEFAULT_LOCAL_SUFFIX, e.g. .env.local.yml
+	LocalFile string
+	// SearchPaths are the directories files are looked up in, the first
+	// one having a file wins. Defaults to CONFIG_PATH_ENV or ".".
+	SearchPaths []string
+	// Profile picks the profile file, defaults to APP_ENV from the
+	// overrides, the environment or the base file
+	Profile string
+	// Overrides win over every other source, keyed by environment variable
+	Overrides map[string]any
+	// AllowEmptyEnv makes variables that are set but empty count as values.
+	// By default they are skipped like unset ones, as compose turns
+	// DB_URL: ${DB_URL} into an empty DB_URL when the host has none.
+	AllowEmptyEnv bool
+	// Viper supplies values ranking above the files and below the
+	// environment, e.g. from a remote provider. Load only reads from it.
+	// Every file is read into an instance of its own, nothing touches the
+	// global viper, so loads are independent and safe to run in parallel.
+	Viper *viper.Viper
+	// MasterKey decrypts enc:v1: values, defaults to MASTER_KEY_ENV. Values
+	// of fields tagged secret may also be file:// and env: references, see
+	// resolveSecret.
+	MasterKey []byte
+}
+
+// field - One tagged field of the struct being loaded
+type field struct {
+	// Env is the environment variable, from the env tag or the field name
+	Env string
+	// Key is the config file key, from the mapstructure tag or Env lowered
+	Key        string
+	Default    string
+	HasDefault bool
+	Required   bool
+	Validate   string
+	// Secret values are masked by Redact and kept out of error messages
+	Secret bool
+	value  reflect.Value
+}
+
+// Load - Fills a T from the config file and the environment, the latter
+// winning. Fields are described with tags:
+//
+//	PORT int `env:"PORT" default:"8080" required:"true" validate:"min=1,max=65535"`
+//	APP_KEY string `env:"APP_KEY" secret:"true"`
+//
+// Struct fields are sections, see fieldsOf, and configs or sections that
+// implement Validator are checked last. Every missing or invalid key is
+// reported in the returned Errors.
+func Load[T any](opts LoadOpts) (*T, error) {
+	config, _, err := LoadWithSources[T](opts)
+	return config, err
+}
+
+// LoadWithSources - Load, also reporting where each value came from
+func LoadWithSources[T any](opts LoadOpts) (*T, Sources, error) {
+	config, sources, err := load[T](opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, sources, nil
+}
+
+// load - Like LoadWithSources, but returns what it could fill next to the error
+func load[T any](opts LoadOpts) (*T, Sources, error) {
+	opts = opts.withDefaults()
+
+	config := new(T)
+
+	fields, err := fieldsOf(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layers, _, err := readLayers(opts)
+	if err != nil {
+		return config, nil, err
+	}
+
+	sources := Sources{}
+	var problems Errors
+
+	for _, f := range fields {
+		raw, source := opts.lookup(f, layers)
+		sources[f.Env] = source
+
+		// Only secrets, other values such as file://migrations are
+		// taken as they are
+		if f.Secret {
+			resolved, err := opts.resolveSecrets(raw)
+			if err != nil {
+				problems = append(problems, &FieldError{Key: f.Env, Err: err})
+				continue
+			}
+			raw = resolved
+		}
+
+		if err := f.set(raw); err != nil {
+			problems = append(problems, &FieldError{Key: f.Env, Err: err})
+		}
+	}
+
+	// Cross field rules only make sense once every field is valid
+	if len(problems) == 0 {
+		problems = validateSections(reflect.ValueOf(config).Elem(), "")
+	}
+
+	if len(problems) > 0 {
+		return config, sources, problems
+	}
+
+	return config, sources, nil
+}
+
+// set - Converts raw, as read from the file or the environment, into the
+// field and validates it. Unset optional fields keep their zero value.
+func (f field) set(raw any) error {
+	if raw == nil || raw == "" {
+		if f.Required {
+			return ErrRequired
+		}
+		return nil
+	}
+
+	converted, err := convert(raw, f.value.Type())
+	if err != nil && f.Secret {
+		return fmt.Errorf("invalid %s", f.value.Type())
+	}
+	if err != nil {
+		return err
+	}
+
+	f.value.Set(converted)
+
+	return validate(f.value, f.Validate)
+}
+
+func convert(raw any, to reflect.Type) (reflect.Value, error) {
+	var value any
+	var err error
+
+	if reflect.TypeOf(raw) == to {
+		return reflect.ValueOf(raw), nil
+	}
+
+	switch {
+	case to == durationType:
+		value, err = cast.ToDurationE(raw)
+	case to.Kind() == reflect.Struct && isTextValue(to):
+		value, err = unmarshalText(raw, to)
+	case to.Kind() == reflect.String:
+		value, err = cast.ToStringE(raw)
+	case to.Kind() == reflect.Bool:
+		value, err = cast.ToBoolE(raw)
+	case to.Kind() == reflect.Int:
+		value, err = cast.ToIntE(raw)
+	case to.Kind() == reflect.Int64:
+		value, err = cast.ToInt64E(raw)
+	case to.Kind() == reflect.Float64:
+		value, err = cast.ToFloat64E(raw)
+	case to.Kind() == reflect.Slice && to.Elem().Kind() == reflect.String:
+		value, err = toStringSlice(raw)
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", to)
+	}
+
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid %s %q", to, fmt.Sprint(raw))
+	}
+
+	return reflect.ValueOf(value).Convert(to), nil
+}
+
+// unmarshalText - Values of types such as time.Time, which parse themselves
+func unmarshalText(raw any, to reflect.Type) (any, error) {
+	text, err := cast.ToStringE(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	value := reflect.New(to)
+	if err := value.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+		return nil, err
+	}
+
+	return value.Elem().Interface(), nil
+}
+
+// toStringSlice - Lists come as YAML sequences or comma separated from the
+// environment
+func toStringSlice(raw any) ([]string, error) {
+	text, ok := raw.(string)
+	if !ok {
+		return cast.ToStringSliceE(raw)
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(text, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+// fieldsOf - The exported fields of the struct config points to. Fields of
+// nested structs are included, their env and file keys prefixed with those of
+// the struct, so DB.MAX_OPEN_CONNS is DB_MAX_OPEN_CONNS and db.max_open_conns.
+// Embedded structs are flattened without a prefix. Fields reflect cannot set
+// are reported instead of panicking on the first Set.
+func fieldsOf(config any) ([]field, error) {
+	v := reflect.ValueOf(config).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct, got %s", v.Type())
+	}
+
+	return appendFields([]field{}, v, "", "")
+}
+
+func appendFields(fields []field, v reflect.Value, envPrefix string, keyPrefix string) ([]field, error) {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() && !(sf.Anonymous && isSection(sf)) {
+			continue
+		}
+
+		f := field{
+			Env:      sf.Tag.Get(TAG_ENV),
+			Key:      sf.Tag.Get(TAG_FILE_KEY),
+			Validate: sf.Tag.Get(TAG_VALIDATE),
+			Required: sf.Tag.Get(TAG_REQUIRED) == "true",
+			Secret:   sf.Tag.Get(TAG_SECRET) == "true",
+			value:    v.Field(i),
+		}
+
+		f.Default, f.HasDefault = sf.Tag.Lookup(TAG_DEFAULT)
+
+		if isSection(sf) {
+			var err error
+
+			if sf.Anonymous && f.Env == "" {
+				if fields, err = appendFields(fields, f.value, envPrefix, keyPrefix); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if f.Env == "" {
+				f.Env = sf.Name
+			}
+			if f.Key == "" {
+				f.Key = strings.ToLower(f.Env)
+			}
+
+			if fields, err = appendFields(fields, f.value, envPrefix+f.Env+"_", keyPrefix+f.Key+"."); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if f.Env == "" {
+			f.Env = sf.Name
+		}
+
+		if f.Key == "" {
+			f.Key = strings.ToLower(f.Env)
+		}
+
+		f.Env = envPrefix + f.Env
+		f.Key = keyPrefix + f.Key
+
+		if !f.value.CanSet() {
+			return nil, fmt.Errorf("%s: field %s cannot be set", v.Type(), sf.Name)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// isSection - Structs other than values parsed from text, such as time.Time
+func isSection(sf reflect.StructField) bool {
+	return sf.Type.Kind() == reflect.Struct && !isTextValue(sf.Type)
+}
+
+func isTextValue(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func (o LoadOpts) withDefaults() LoadOpts {
+	if o.ConfigFile == "" {
+		o.ConfigFile = DEFAULT_CONFIG_FILE
+	}
+
+	if o.LocalFile == "" {
+		o.LocalFile = withSuffix(o.ConfigFile, DEFAULT_LOCAL_SUFFIX)
+	}
+
+	if len(o.SearchPaths) == 0 {
+		o.SearchPaths = defaultSearchPaths()
+	}
+
+	return o
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type loadTestConfig struct {
+	Name     string        `env:"LOAD_TEST_NAME" required:"true"`
+	Port     int           `env:"LOAD_TEST_PORT" default:"8080" validate:"min=1,max=65535"`
+	Mode     string        `env:"LOAD_TEST_MODE" default:"fast" validate:"oneof=fast safe"`
+	Timeout  time.Duration `env:"LOAD_TEST_TIMEOUT" default:"5s" validate:"min=1s"`
+	Upstream string        `env:"LOAD_TEST_UPSTREAM" validate:"url"`
+	Hosts    []string      `env:"LOAD_TEST_HOSTS"`
+	Debug    bool          `mapstructure:"load_test_debug_flag" env:"LOAD_TEST_DEBUG"`
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), ".env.yml")
+	assert.Nil(t, os.WriteFile(file, []byte(contents), 0o600))
+
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	file := writeConfigFile(t, "load_test_name: from-file\nload_test_hosts: [a, b]\nload_test_debug_flag: true\n")
+
+	t.Setenv("LOAD_TEST_PORT", "9090")
+	t.Setenv("LOAD_TEST_UPSTREAM", "https://api.example.com")
+
+	config, err := Load[loadTestConfig](LoadOpts{ConfigFile: file})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "from-file", config.Name)
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, "fast", config.Mode)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+	assert.Equal(t, "https://api.example.com", config.Upstream)
+	assert.Equal(t, []string{"a", "b"}, config.Hosts)
+	assert.True(t, config.Debug)
+
+	// The environment wins over the file
+	t.Setenv("LOAD_TEST_NAME", "from-env")
+	t.Setenv("LOAD_TEST_HOSTS", "c, d,")
+
+	config, err = Load[loadTestConfig](LoadOpts{ConfigFile: file})
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", config.Name)
+	assert.Equal(t, []string{"c", "d"}, config.Hosts)
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := writeConfigFile(t, "load_test_mode: reckless\n")
+
+	t.Setenv("LOAD_TEST_NAME", "")
+	t.Setenv("LOAD_TEST_PORT", "70000")
+	t.Setenv("LOAD_TEST_TIMEOUT", "soon")
+	t.Setenv("LOAD_TEST_UPSTREAM", "api.example.com")
+
+	config, err := Load[loadTestConfig](LoadOpts{ConfigFile: file})
+	assert.Nil(t, config)
+
+	var problems Errors
+	assert.True(t, errors.As(err, &problems))
+	assert.ErrorIs(t, err, ErrRequired)
+
+	keys := []string{}
+	for _, problem := range problems {
+		keys = append(keys, problem.Key)
+	}
+	assert.Equal(t, []string{"LOAD_TEST_NAME", "LOAD_TEST_PORT", "LOAD_TEST_MODE", "LOAD_TEST_TIMEOUT", "LOAD_TEST_UPSTREAM"}, keys)
+
+	assert.Contains(t, err.Error(), "5 problem(s)")
+	assert.Contains(t, err.Error(), "LOAD_TEST_PORT: must be at most 65535")
+	assert.Contains(t, err.Error(), "LOAD_TEST_MODE: must be one of fast, safe")
+}
+
+type loadTestSection struct {
+	Level string `mapstructure:"level" env:"LEVEL" default:"info"`
+	Limit int    `mapstructure:"limit" env:"LIMIT" validate:"min=0"`
+}
+
+func (s *loadTestSection) Validate() error {
+	if s.Level == "debug" && s.Limit > 0 {
+		return &FieldError{Key: "LIMIT", Err: errors.New("must be 0 when debugging")}
+	}
+	return nil
+}
+
+type loadTestBase struct {
+	Name string          `mapstructure:"name" env:"LOAD_TEST_NESTED_NAME"`
+	Log  loadTestSection `mapstructure:"log" env:"LOAD_TEST_LOG"`
+}
+
+type loadTestService struct {
+	loadTestBase
+	Queue loadTestSection `mapstructure:"queue" env:"LOAD_TEST_QUEUE"`
+}
+
+func TestLoadNested(t *testing.T) {
+	file := writeConfigFile(t, "name: api\nlog:\n  level: warn\nqueue:\n  limit: 3\n")
+
+	t.Setenv("LOAD_TEST_QUEUE_LEVEL", "error")
+
+	config, sources, err := LoadWithSources[loadTestService](LoadOpts{ConfigFile: file})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "api", config.Name)
+	assert.Equal(t, "warn", config.Log.Level)
+	assert.Equal(t, "error", config.Queue.Level)
+	assert.Equal(t, 3, config.Queue.Limit)
+
+	assert.Equal(t, SOURCE_FILE, sources["LOAD_TEST_LOG_LEVEL"].Kind)
+	assert.Equal(t, SOURCE_ENV, sources["LOAD_TEST_QUEUE_LEVEL"].Kind)
+	assert.Equal(t, SOURCE_FILE, sources["LOAD_TEST_QUEUE_LIMIT"].Kind)
+
+	t.Run("Sections are validated with keys under their prefix", func(t *testing.T) {
+		t.Setenv("LOAD_TEST_QUEUE_LEVEL", "debug")
+
+		_, err := Load[loadTestService](LoadOpts{ConfigFile: file})
+
+		var problems Errors
+		assert.True(t, errors.As(err, &problems))
+		assert.Len(t, problems, 1)
+		assert.Equal(t, "LOAD_TEST_QUEUE_LIMIT", problems[0].Key)
+	})
+}
+
+// loadTestVersion - A struct parsing itself, loaded as one value
+type loadTestVersion struct {
+	Major, Minor int
+}
+
+func (v *loadTestVersion) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "v%d.%d", &v.Major, &v.Minor)
+	return err
+}
+
+type loadTestValues struct {
+	Since   time.Time       `mapstructure:"since" env:"LOAD_TEST_SINCE" required:"true"`
+	Until   time.Time       `mapstructure:"until" env:"LOAD_TEST_UNTIL"`
+	Version loadTestVersion `mapstructure:"version" env:"LOAD_TEST_VERSION" default:"v1.2"`
+}
+
+func TestLoadTextValues(t *testing.T) {
+	file := writeConfigFile(t, "until: 2024-06-01T00:00:00Z\n")
+
+	t.Setenv("LOAD_TEST_SINCE", "2024-01-02T03:04:05Z")
+
+	config, sources, err := LoadWithSources[loadTestValues](LoadOpts{ConfigFile: file})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), config.Since.UTC())
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), config.Until.UTC())
+	assert.Equal(t, loadTestVersion{Major: 1, Minor: 2}, config.Version)
+	assert.Equal(t, SOURCE_ENV, sources["LOAD_TEST_SINCE"].Kind)
+
+	t.Run("Invalid and missing values are reported", func(t *testing.T) {
+		t.Setenv("LOAD_TEST_SINCE", "")
+		t.Setenv("LOAD_TEST_VERSION", "latest")
+
+		_, err := Load[loadTestValues](LoadOpts{ConfigFile: file})
+
+		var problems Errors
+		assert.True(t, errors.As(err, &problems))
+		assert.Len(t, problems, 2)
+		assert.Equal(t, "LOAD_TEST_SINCE", problems[0].Key)
+		assert.Equal(t, "LOAD_TEST_VERSION", problems[1].Key)
+	})
+}
+
+func TestLoadNotAStruct(t *testing.T) {
+	_, err := Load[string](LoadOpts{})
+	assert.ErrorContains(t, err, "must be a struct")
+}
+
+func TestLoadViper(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".env.yml": "load_test_name: from-file\nload_test_port: 1000\nload_test_mode: safe\n"})
+
+	v := viper.New()
+	v.Set("load_test_name", "from-viper")
+	v.Set("load_test_port", 2000)
+
+	t.Setenv("LOAD_TEST_PORT", "3000")
+
+	config, sources, err := LoadWithSources[loadTestConfig](LoadOpts{SearchPaths: []string{dir}, Viper: v})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "from-viper", config.Name)
+	assert.Equal(t, 3000, config.Port)
+	assert.Equal(t, "safe", config.Mode)
+	assert.Equal(t, Source{Kind: SOURCE_VIPER}, sources["LOAD_TEST_NAME"])
+
+	// Loading neither reads nor writes the global instance
+	assert.False(t, viper.IsSet("load_test_name"))
+	viper.Set("load_test_mode", "fast")
+	defer viper.Reset()
+
+	config, err = Load[loadTestConfig](LoadOpts{SearchPaths: []string{dir}})
+	assert.Nil(t, err)
+	assert.Equal(t, "safe", config.Mode)
+}
+
+func TestLoadParallel(t *testing.T) {
+	for _, name := range []string{"billing", "search", "mailer", "gateway"} {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{".env.yml": "load_test_name: " + name + "\n"})
+
+			for i := 0; i < 20; i++ {
+				config, err := Load[loadTestConfig](LoadOpts{
+					SearchPaths: []string{dir},
+					Overrides:   map[string]any{"LOAD_TEST_PORT": 8000 + i},
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, name, config.Name)
+				assert.Equal(t, 8000+i, config.Port)
+			}
+		})
+	}
+}
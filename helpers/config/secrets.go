@@ -0,0 +1,183 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SECRET_FILE_PREFIX      = "file://"
+	SECRET_ENV_PREFIX       = "env:"
+	SECRET_ENCRYPTED_PREFIX = "enc:v1:"
+
+	// MASTER_KEY_ENV holds the base64 key enc:v1: values are decrypted with
+	// when LoadOpts.MasterKey is empty
+	MASTER_KEY_ENV  = "CONFIG_MASTER_KEY"
+	MASTER_KEY_SIZE = 32
+)
+
+var (
+	ErrNoMasterKey    = errors.New("encrypted value found but no master key is set in " + MASTER_KEY_ENV)
+	ErrInvalidCipher  = errors.New("encrypted value is malformed or was encrypted under another key")
+	ErrInvalidKeySize = fmt.Errorf("master key must be %d bytes", MASTER_KEY_SIZE)
+)
+
+// GenerateMasterKey - A random key, base64 encoded as MASTER_KEY_ENV expects
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, MASTER_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseMasterKey - Decodes a base64 key made by GenerateMasterKey
+func ParseMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not base64: %w", err)
+	}
+
+	if len(key) != MASTER_KEY_SIZE {
+		return nil, ErrInvalidKeySize
+	}
+
+	return key, nil
+}
+
+// Encrypt - Seals plaintext under key with AES-256-GCM into an enc:v1: value
+// that can be committed to a config file
+func Encrypt(plaintext string, key []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return SECRET_ENCRYPTED_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt - Opens a value made by Encrypt
+func Decrypt(value string, key []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(value, SECRET_ENCRYPTED_PREFIX)
+	if !ok {
+		return "", fmt.Errorf("value does not start with %s", SECRET_ENCRYPTED_PREFIX)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCipher
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCipher
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidCipher
+	}
+
+	return string(plaintext), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != MASTER_KEY_SIZE {
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// resolveSecrets - Replaces references in raw, or in the items of a list,
+// with what they point to
+func (o LoadOpts) resolveSecrets(raw any) (any, error) {
+	switch raw := raw.(type) {
+	case string:
+		return o.resolveSecret(raw)
+	case []any:
+		resolved := make([]any, len(raw))
+		for i, item := range raw {
+			value, err := o.resolveSecrets(item)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = value
+		}
+		return resolved, nil
+	default:
+		return raw, nil
+	}
+}
+
+// resolveSecret - file:///run/secrets/db_url reads the file, env:OTHER_VAR
+// reads the variable and enc:v1:... decrypts under the master key
+func (o LoadOpts) resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SECRET_FILE_PREFIX):
+		path := strings.TrimPrefix(value, SECRET_FILE_PREFIX)
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+
+		// Editors and `echo` leave a trailing newline
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	case strings.HasPrefix(value, SECRET_ENV_PREFIX):
+		name := strings.TrimPrefix(value, SECRET_ENV_PREFIX)
+
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("referenced variable %s is not set", name)
+		}
+
+		return resolved, nil
+	case strings.HasPrefix(value, SECRET_ENCRYPTED_PREFIX):
+		key, err := o.masterKey()
+		if err != nil {
+			return "", err
+		}
+
+		return Decrypt(value, key)
+	default:
+		return value, nil
+	}
+}
+
+func (o LoadOpts) masterKey() ([]byte, error) {
+	if len(o.MasterKey) > 0 {
+		return o.MasterKey, nil
+	}
+
+	encoded := os.Getenv(MASTER_KEY_ENV)
+	if encoded == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	return ParseMasterKey(encoded)
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type secretsTestConfig struct {
+	DbURL      string   `env:"SECRETS_TEST_DB_URL" validate:"url" secret:"true"`
+	AppKey     string   `env:"SECRETS_TEST_APP_KEY" secret:"true"`
+	JwtSecret  string   `env:"SECRETS_TEST_JWT_SECRET" secret:"true"`
+	Tokens     []string `env:"SECRETS_TEST_TOKENS" secret:"true"`
+	Migrations string   `env:"SECRETS_TEST_MIGRATIONS"`
+	Name       string   `env:"SECRETS_TEST_NAME"`
+}
+
+func TestEncrypt(t *testing.T) {
+	encoded, err := GenerateMasterKey()
+	assert.Nil(t, err)
+
+	key, err := ParseMasterKey(encoded)
+	assert.Nil(t, err)
+
+	value, err := Encrypt("s3cret", key)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(value, SECRET_ENCRYPTED_PREFIX))
+	assert.NotContains(t, value, "s3cret")
+
+	again, _ := Encrypt("s3cret", key)
+	assert.NotEqual(t, value, again, "every value gets a fresh nonce")
+
+	plaintext, err := Decrypt(value, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	otherKey, _ := GenerateMasterKey()
+	other, _ := ParseMasterKey(otherKey)
+	_, err = Decrypt(value, other)
+	assert.ErrorIs(t, err, ErrInvalidCipher)
+
+	_, err = Decrypt(SECRET_ENCRYPTED_PREFIX+"bm9wZQ==", key)
+	assert.ErrorIs(t, err, ErrInvalidCipher)
+
+	_, err = Encrypt("s3cret", []byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidKeySize)
+
+	_, err = ParseMasterKey("c2hvcnQ=")
+	assert.ErrorIs(t, err, ErrInvalidKeySize)
+}
+
+func TestLoadSecrets(t *testing.T) {
+	encoded, _ := GenerateMasterKey()
+	key, _ := ParseMasterKey(encoded)
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db_url")
+	assert.Nil(t, os.WriteFile(secretFile, []byte("postgres://app:pw@db:5432/app\n"), 0o600))
+
+	encryptedKey, _ := Encrypt("base64:app-key", key)
+	encryptedToken, _ := Encrypt("token-2", key)
+
+	writeFiles(t, dir, map[string]string{
+		".env.yml": "secrets_test_app_key: " + encryptedKey + "\n" +
+			"secrets_test_tokens: [token-1, " + encryptedToken + "]\n",
+	})
+
+	t.Setenv(MASTER_KEY_ENV, encoded)
+	t.Setenv("SECRETS_TEST_DB_URL", SECRET_FILE_PREFIX+secretFile)
+	t.Setenv("SECRETS_TEST_JWT_SECRET", SECRET_ENV_PREFIX+"SECRETS_TEST_SHARED")
+	t.Setenv("SECRETS_TEST_SHARED", "jwt-secret")
+	// Values of fields not tagged secret are never resolved
+	t.Setenv("SECRETS_TEST_MIGRATIONS", "file://migrations")
+	t.Setenv("SECRETS_TEST_NAME", SECRET_ENV_PREFIX+"SECRETS_TEST_SHARED")
+
+	config, err := Load[secretsTestConfig](LoadOpts{SearchPaths: []string{dir}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "postgres://app:pw@db:5432/app", config.DbURL)
+	assert.Equal(t, "base64:app-key", config.AppKey)
+	assert.Equal(t, "jwt-secret", config.JwtSecret)
+	assert.Equal(t, "file://migrations", config.Migrations)
+	assert.Equal(t, SECRET_ENV_PREFIX+"SECRETS_TEST_SHARED", config.Name)
+	assert.Equal(t, []string{"token-1", "token-2"}, config.Tokens)
+
+	// Without the master key the encrypted values cannot be read
+	t.Setenv(MASTER_KEY_ENV, "")
+	_, err = Load[secretsTestConfig](LoadOpts{SearchPaths: []string{dir}})
+	assert.ErrorIs(t, err, ErrNoMasterKey)
+
+	// Passing it explicitly works as well
+	config, err = Load[secretsTestConfig](LoadOpts{SearchPaths: []string{dir}, MasterKey: key})
+	assert.Nil(t, err)
+	assert.Equal(t, "base64:app-key", config.AppKey)
+}
+
+func TestLoadSecretErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("SECRETS_TEST_DB_URL", SECRET_FILE_PREFIX+filepath.Join(dir, "missing"))
+	t.Setenv("SECRETS_TEST_JWT_SECRET", SECRET_ENV_PREFIX+"SECRETS_TEST_UNSET")
+
+	_, err := Load[secretsTestConfig](LoadOpts{SearchPaths: []string{dir}})
+
+	var problems Errors
+	assert.ErrorAs(t, err, &problems)
+	assert.Len(t, problems, 2)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "SECRETS_TEST_JWT_SECRET: referenced variable SECRETS_TEST_UNSET is not set")
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// LogConfig - LOG_LEVEL and LOG_FORMAT
+type LogConfig struct {
+	LEVEL  string `mapstructure:"level" env:"LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	FORMAT string `mapstructure:"format" env:"FORMAT" default:"json" validate:"oneof=json text"`
+}
+
+// SlogLevel - LEVEL as a slog.Level
+func (c LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LEVEL)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// JwtConfig - Signing secret and claims of the tokens a service issues
+type JwtConfig struct {
+	SECRET            string        `mapstructure:"secret" env:"SECRET" secret:"true"`
+	ISSUER            string        `mapstructure:"issuer" env:"ISSUER"`
+	AUDIENCE          []string      `mapstructure:"audience" env:"AUDIENCE"`
+	ACCESS_TOKEN_TTL  time.Duration `mapstructure:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m" validate:"min=1s"`
+	REFRESH_TOKEN_TTL time.Duration `mapstructure:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"720h" validate:"min=1s"`
+}
+
+func (c *JwtConfig) Validate() error {
+	if c.REFRESH_TOKEN_TTL < c.ACCESS_TOKEN_TTL {
+		return &FieldError{Key: "REFRESH_TOKEN_TTL", Err: errors.New("must not be shorter than ACCESS_TOKEN_TTL")}
+	}
+	return nil
+}
+
+// HttpConfig - Server timeouts and the origins allowed by CORS, "*" allows
+// any origin
+type HttpConfig struct {
+	READ_TIMEOUT  time.Duration `mapstructure:"read_timeout" env:"READ_TIMEOUT" default:"15s" validate:"min=0s"`
+	WRITE_TIMEOUT time.Duration `mapstructure:"write_timeout" env:"WRITE_TIMEOUT" default:"15s" validate:"min=0s"`
+	IDLE_TIMEOUT  time.Duration `mapstructure:"idle_timeout" env:"IDLE_TIMEOUT" default:"60s" validate:"min=0s"`
+	CORS_ORIGINS  []string      `mapstructure:"cors_origins" env:"CORS_ORIGINS"`
+}
+
+func (c *HttpConfig) Validate() error {
+	for _, origin := range c.CORS_ORIGINS {
+		if origin == "*" {
+			continue
+		}
+		if err := checkURL(origin); err != nil {
+			return &FieldError{Key: "CORS_ORIGINS", Err: errors.New("must be * or origins such as https://app.example.com")}
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin - Whether CORS_ORIGINS lets origin in
+func (c HttpConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.CORS_ORIGINS {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// DbConfig - Connection pool of every database in DB_URL and DB_REPLICA_URLS.
+// A zero STATEMENT_TIMEOUT leaves the server default in place.
+type DbConfig struct {
+	MAX_OPEN_CONNS     int           `mapstructure:"max_open_conns" env:"MAX_OPEN_CONNS" default:"25" validate:"min=0"`
+	MAX_IDLE_CONNS     int           `mapstructure:"max_idle_conns" env:"MAX_IDLE_CONNS" default:"5" validate:"min=0"`
+	CONN_MAX_LIFETIME  time.Duration `mapstructure:"conn_max_lifetime" env:"CONN_MAX_LIFETIME" default:"30m" validate:"min=0s"`
+	CONN_MAX_IDLE_TIME time.Duration `mapstructure:"conn_max_idle_time" env:"CONN_MAX_IDLE_TIME" default:"5m" validate:"min=0s"`
+	STATEMENT_TIMEOUT  time.Duration `mapstructure:"statement_timeout" env:"STATEMENT_TIMEOUT" default:"0s" validate:"min=0s"`
+}
+
+func (c *DbConfig) Validate() error {
+	if c.MAX_OPEN_CONNS > 0 && c.MAX_IDLE_CONNS > c.MAX_OPEN_CONNS {
+		return &FieldError{Key: "MAX_IDLE_CONNS", Err: errors.New("must not exceed MAX_OPEN_CONNS")}
+	}
+	return nil
+}
+
+// TelemetryConfig - Where traces and metrics are exported to, see
+// Config.ServiceName for the name they are reported under
+type TelemetryConfig struct {
+	ENABLED      bool    `mapstructure:"enabled" env:"ENABLED"`
+	EXPORTER     string  `mapstructure:"exporter" env:"EXPORTER" default:"otlp" validate:"oneof=otlp stdout"`
+	ENDPOINT     string  `mapstructure:"endpoint" env:"ENDPOINT" validate:"url"`
+	SERVICE_NAME string  `mapstructure:"service_name" env:"SERVICE_NAME"`
+	SAMPLE_RATIO float64 `mapstructure:"sample_ratio" env:"SAMPLE_RATIO" default:"1" validate:"min=0,max=1"`
+}
+
+func (c *TelemetryConfig) Validate() error {
+	if c.ENABLED && c.EXPORTER == "otlp" && c.ENDPOINT == "" {
+		return &FieldError{Key: "ENDPOINT", Err: errors.New("is required by the otlp exporter")}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSectionDefaults(t *testing.T) {
+	config, err := Load[Config](LoadOpts{
+		SearchPaths: []string{t.TempDir()},
+		Overrides:   map[string]any{"APP_NAME": "api"},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "info", config.LOG.LEVEL)
+	assert.Equal(t, "json", config.LOG.FORMAT)
+	assert.Equal(t, "15m0s", config.JWT.ACCESS_TOKEN_TTL.String())
+	assert.Equal(t, "15s", config.HTTP.READ_TIMEOUT.String())
+	assert.Equal(t, 25, config.DB.MAX_OPEN_CONNS)
+	assert.Equal(t, 5, config.DB.MAX_IDLE_CONNS)
+	assert.Zero(t, config.DB.STATEMENT_TIMEOUT)
+	assert.False(t, config.TELEMETRY.ENABLED)
+	assert.Equal(t, 1.0, config.TELEMETRY.SAMPLE_RATIO)
+	assert.Equal(t, "api", config.ServiceName())
+}
+
+func TestSectionValidation(t *testing.T) {
+	cases := []struct {
+		name      string
+		overrides map[string]any
+		key       string
+	}{
+		{"Unknown log level", map[string]any{"LOG_LEVEL": "verbose"}, "LOG_LEVEL"},
+		{"Refresh shorter than access", map[string]any{"JWT_ACCESS_TOKEN_TTL": "1h", "JWT_REFRESH_TOKEN_TTL": "30m"}, "JWT_REFRESH_TOKEN_TTL"},
+		{"Origin without scheme", map[string]any{"HTTP_CORS_ORIGINS": "app.example.com"}, "HTTP_CORS_ORIGINS"},
+		{"More idle than open", map[string]any{"DB_MAX_OPEN_CONNS": 2, "DB_MAX_IDLE_CONNS": 4}, "DB_MAX_IDLE_CONNS"},
+		{"Otlp without endpoint", map[string]any{"TELEMETRY_ENABLED": true}, "TELEMETRY_ENDPOINT"},
+		{"Sample ratio above 1", map[string]any{"TELEMETRY_SAMPLE_RATIO": 1.5}, "TELEMETRY_SAMPLE_RATIO"},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.overrides["APP_NAME"] = "api"
+
+			_, err := Load[Config](LoadOpts{SearchPaths: []string{t.TempDir()}, Overrides: c.overrides})
+
+			var problems Errors
+			assert.True(t, errors.As(err, &problems))
+			assert.Len(t, problems, 1)
+			assert.Equal(t, c.key, problems[0].Key)
+		})
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelWarn, LogConfig{LEVEL: "warn"}.SlogLevel())
+	assert.Equal(t, slog.LevelInfo, LogConfig{}.SlogLevel())
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	config := HttpConfig{CORS_ORIGINS: []string{"https://app.example.com/"}}
+
+	assert.True(t, config.AllowsOrigin("https://app.example.com"))
+	assert.False(t, config.AllowsOrigin("https://evil.example.com"))
+	assert.True(t, HttpConfig{CORS_ORIGINS: []string{"*"}}.AllowsOrigin("https://any.example.com"))
+}
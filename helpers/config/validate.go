@@ -0,0 +1,296 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FieldError - Why the value of one key was rejected
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors - Every key Load rejected, so all of them can be fixed at once
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("invalid config, %d problem(s):", len(e)))
+	for _, err := range e {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+var ErrRequired = errors.New("is required")
+
+// Validator - Implemented by configs and their sections that have rules
+// spanning several fields. Validate runs after every field is loaded and
+// valid, innermost sections first.
+type Validator interface {
+	Validate() error
+}
+
+// guarded - Implemented by sections with rules that must hold whatever the
+// embedding config does, see Config.Guardrails
+type guarded interface {
+	Guardrails() error
+}
+
+// validateSections - Runs Validator and guarded on v and every section in
+// it. The keys
+// of a *FieldError or Errors returned are relative to the section, other
+// errors are reported under the env prefix of the section.
+func validateSections(v reflect.Value, envPrefix string) Errors {
+	return validateSection(v, envPrefix, true)
+}
+
+// validateSection - Embedded sections are not validated on their own when v
+// is a Validator, Validate is either promoted from them or overrides theirs.
+// Guardrails run on the section declaring them, so embedding cannot skip or
+// repeat them.
+func validateSection(v reflect.Value, envPrefix string, self bool) Errors {
+	var problems Errors
+
+	var validator Validator
+	ok := false
+	if v.Addr().CanInterface() {
+		validator, ok = v.Addr().Interface().(Validator)
+		ok = ok && self
+
+		if guard, isGuarded := v.Addr().Interface().(guarded); isGuarded && !embedsGuarded(v) {
+			problems = appendProblems(problems, v, envPrefix, guard.Guardrails())
+		}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !isSection(sf) || !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+
+		prefix := envPrefix
+		if env := sf.Tag.Get(TAG_ENV); env != "" || !sf.Anonymous {
+			if env == "" {
+				env = sf.Name
+			}
+			prefix += env + "_"
+		}
+
+		problems = append(problems, validateSection(v.Field(i), prefix, !(sf.Anonymous && ok))...)
+	}
+
+	if !ok {
+		return problems
+	}
+
+	return appendProblems(problems, v, envPrefix, validator.Validate())
+}
+
+func embedsGuarded(v reflect.Value) bool {
+	guardedType := reflect.TypeOf((*guarded)(nil)).Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if sf.Anonymous && reflect.PointerTo(sf.Type).Implements(guardedType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendProblems - Adds err, returned by a section of v, to problems
+func appendProblems(problems Errors, v reflect.Value, envPrefix string, err error) Errors {
+	var fieldErr *FieldError
+	var errs Errors
+	switch {
+	case err == nil:
+	case errors.As(err, &errs):
+		for _, e := range errs {
+			problems = append(problems, &FieldError{Key: envPrefix + e.Key, Err: e.Err})
+		}
+	case errors.As(err, &fieldErr):
+		problems = append(problems, &FieldError{Key: envPrefix + fieldErr.Key, Err: fieldErr.Err})
+	default:
+		key := strings.TrimSuffix(envPrefix, "_")
+		if key == "" {
+			key = v.Type().Name()
+		}
+		problems = append(problems, &FieldError{Key: key, Err: err})
+	}
+
+	return problems
+}
+
+// validate - Checks value against rules such as "min=1,max=65535",
+// "oneof=a b c", "url", "dsn" or "duration"
+func validate(value reflect.Value, rules string) error {
+	if rules == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		var err error
+		switch name {
+		case "min":
+			err = checkBound(value, arg, func(n, bound float64) bool { return n >= bound }, "at least")
+		case "max":
+			err = checkBound(value, arg, func(n, bound float64) bool { return n <= bound }, "at most")
+		case "oneof":
+			options := strings.Fields(arg)
+			if !slices.Contains(options, fmt.Sprint(value.Interface())) {
+				err = fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+			}
+		case "url":
+			err = checkURL(value.String())
+		case "dsn":
+			err = checkDSN(value.String())
+		case "duration":
+			if value.Type() != durationType {
+				if _, parseErr := time.ParseDuration(value.String()); parseErr != nil {
+					err = fmt.Errorf("must be a duration such as 30s or 5m")
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown validation rule %q", name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBound - Numbers compare by value, durations by length of time and
+// strings and slices by length
+func checkBound(value reflect.Value, arg string, ok func(n, bound float64) bool, word string) error {
+	var n, bound float64
+	var err error
+
+	switch {
+	case value.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(arg)
+		n, bound = float64(value.Int()), float64(d)
+	case value.CanInt():
+		n = float64(value.Int())
+		bound, err = strconv.ParseFloat(arg, 64)
+	case value.CanUint():
+		n = float64(value.Uint())
+		bound, err = strconv.ParseFloat(arg, 64)
+	case value.CanFloat():
+		n = value.Float()
+		bound, err = strconv.ParseFloat(arg, 64)
+	case value.Kind() == reflect.String || value.Kind() == reflect.Slice:
+		n = float64(value.Len())
+		bound, err = strconv.ParseFloat(arg, 64)
+		word = "of length " + word
+	default:
+		return fmt.Errorf("cannot bound a %s", value.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid bound %q: %w", arg, err)
+	}
+
+	if !ok(n, bound) {
+		return fmt.Errorf("must be %s %s", word, arg)
+	}
+
+	return nil
+}
+
+func checkURL(raw string) error {
+	// The parse error quotes the value, which may hold a password
+	u, err := url.Parse(raw)
+	if err != nil {
+		return errors.New("must be a url")
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("must be an absolute url such as postgres://host/db")
+	}
+
+	return nil
+}
+
+// checkDSN - A postgres URL or a libpq key=value connection string such as
+// host=db dbname=app password='a b'
+func checkDSN(raw string) error {
+	if strings.Contains(raw, "://") {
+		return checkURL(raw)
+	}
+
+	invalid := errors.New("must be a url such as postgres://host/db or a connection string such as host=db dbname=app")
+
+	rest := strings.TrimSpace(raw)
+	if rest == "" {
+		return invalid
+	}
+
+	for rest != "" {
+		key, value, found := strings.Cut(rest, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t\n'") {
+			return invalid
+		}
+
+		value = strings.TrimLeft(value, " \t\n")
+		if !strings.HasPrefix(value, "'") {
+			rest = ""
+			if end := strings.IndexAny(value, " \t\n"); end >= 0 {
+				rest = strings.TrimSpace(value[end:])
+			}
+			continue
+		}
+
+		// Quoted values may hold spaces and \' escapes
+		end := -1
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\\' {
+				i++
+				continue
+			}
+			if value[i] == '\'' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return invalid
+		}
+		rest = strings.TrimSpace(value[end+1:])
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		value any
+		rules string
+		err   string
+	}{
+		{5, "min=1,max=10", ""},
+		{0, "min=1", "must be at least 1"},
+		{11, "max=10", "must be at most 10"},
+		{1.5, "max=1", "must be at most 1"},
+		{"short", "min=8", "must be of length at least 8"},
+		{[]string{"a", "b"}, "max=1", "must be of length at most 1"},
+		{2 * time.Second, "min=1s,max=1m", ""},
+		{500 * time.Millisecond, "min=1s", "must be at least 1s"},
+		{"staging", "oneof=development staging", ""},
+		{"prod", "oneof=development staging", "must be one of development, staging"},
+		{"postgres://db:5432/app", "url", ""},
+		{"db:5432/app", "url", "must be an absolute url"},
+		{"postgres://db:5432/app", "dsn", ""},
+		{"postgres://db:port/app", "dsn", "must be a url"},
+		{"host=db dbname=app", "dsn", ""},
+		{"host=db password='a \\' b' sslmode=require", "dsn", ""},
+		{"host = db  dbname=app", "dsn", ""},
+		{"host=db password='open", "dsn", "must be a url such as postgres://host/db or a connection string"},
+		{"db:5432/app", "dsn", "must be a url such as postgres://host/db or a connection string"},
+		{"", "dsn", "must be a url"},
+		{"90s", "duration", ""},
+		{"90", "duration", "must be a duration"},
+		{1, "min=one", "invalid bound"},
+		{1, "between=1 2", "unknown validation rule"},
+		{"anything", "", ""},
+	}
+
+	for _, c := range cases {
+		err := validate(reflect.ValueOf(c.value), c.rules)
+		if c.err == "" {
+			assert.Nil(t, err, "%v %s", c.value, c.rules)
+		} else {
+			assert.ErrorContains(t, err, c.err, "%v %s", c.value, c.rules)
+		}
+	}
+}
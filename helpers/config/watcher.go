@@ -0,0 +1,294 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DEFAULT_RELOAD_DEBOUNCE groups the several events editors produce when
+	// saving into one reload
+	DEFAULT_RELOAD_DEBOUNCE = 100 * time.Millisecond
+
+	// KUBERNETES_DATA_LINK is the symlink a mounted ConfigMap or Secret
+	// swaps to update its files at once. The files themselves are links
+	// through it and never change, so no event names them.
+	KUBERNETES_DATA_LINK = "..data"
+)
+
+type WatchOpts[T any] struct {
+	// Debounce defaults to DEFAULT_RELOAD_DEBOUNCE
+	Debounce time.Duration
+	// Validate runs on every loaded config after the tag validation, a
+	// non nil error rejects the reload
+	Validate func(config *T) error
+	// OnError receives rejected reloads and watch errors, defaults to
+	// logging them
+	OnError func(err error)
+}
+
+// Watcher - Reloads a T whenever one of its config files changes. A reload
+// that fails to load or validate is rejected, the previous config stays
+// current and the error goes to WatchOpts.OnError.
+type Watcher[T any] struct {
+	opts        LoadOpts
+	watchOpts   WatchOpts[T]
+	current     atomic.Pointer[T]
+	sources     atomic.Pointer[Sources]
+	reloadMu    sync.Mutex
+	mu          sync.Mutex
+	subscribers map[uint64]func(old, new *T)
+	nextId      uint64
+	fsw         *fsnotify.Watcher
+	stop        chan struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewWatcher - Loads the config, failing like Load does, and starts watching
+// the search paths for changes to its files
+func NewWatcher[T any](opts LoadOpts, watchOpts WatchOpts[T]) (*Watcher[T], error) {
+	opts = opts.withDefaults()
+	watchOpts = watchOpts.withDefaults()
+
+	w := &Watcher[T]{
+		opts:        opts,
+		watchOpts:   watchOpts,
+		subscribers: map[uint64]func(old, new *T){},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	config, sources, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current.Store(config)
+	w.sources.Store(&sources)
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w.fsw = fsw
+
+	// Directories rather than files, editors replace files instead of
+	// writing them in place and Kubernetes swaps a symlink to them
+	for _, dir := range opts.watchDirs() {
+		if err := fsw.Add(dir); err != nil {
+			fsw.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Current - The config in effect, never modify it
+func (w *Watcher[T]) Current() *T {
+	return w.current.Load()
+}
+
+// Sources - Where each value of Current came from
+func (w *Watcher[T]) Sources() Sources {
+	return *w.sources.Load()
+}
+
+// Subscribe - Calls fn with the previous and the new config after every
+// accepted reload, from the goroutine reloading, so fn should return quickly.
+// fn may call Reload. The returned func unsubscribes.
+func (w *Watcher[T]) Subscribe(fn func(old, new *T)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextId
+	w.nextId++
+	w.subscribers[id] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+// SubscribeValue - Calls fn only when the value selected from the config
+// changes, e.g. the log level:
+//
+//	config.SubscribeValue(w, func(c *Config) string { return c.LOG.LEVEL }, setLevel)
+func SubscribeValue[T any, V comparable](w *Watcher[T], selector func(*T) V, fn func(old, new V)) func() {
+	return w.Subscribe(func(old, new *T) {
+		oldValue, newValue := selector(old), selector(new)
+		if oldValue != newValue {
+			fn(oldValue, newValue)
+		}
+	})
+}
+
+// Reload - Loads and validates the config now and swaps it in. On error the
+// current config is kept and the error is both returned and reported.
+// Subscribers are notified after the swap, outside the lock, so they may call
+// Reload themselves. A newer reload takes over notifying from an older one.
+func (w *Watcher[T]) Reload() error {
+	w.reloadMu.Lock()
+
+	config, sources, err := w.load()
+	if err != nil {
+		w.reloadMu.Unlock()
+		err = fmt.Errorf("config reload rejected: %w", err)
+		w.watchOpts.OnError(err)
+		return err
+	}
+
+	old := w.current.Swap(config)
+	w.sources.Store(&sources)
+
+	w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	ids := make([]uint64, 0, len(w.subscribers))
+	for id := range w.subscribers {
+		ids = append(ids, id)
+	}
+	w.mu.Unlock()
+
+	// In subscription order, unsubscribing from inside fn is fine
+	slices.Sort(ids)
+	for _, id := range ids {
+		// Superseded, the newer reload notifies every subscriber
+		if w.current.Load() != config {
+			return nil
+		}
+
+		w.mu.Lock()
+		fn, ok := w.subscribers[id]
+		w.mu.Unlock()
+
+		if ok {
+			fn(old, config)
+		}
+	}
+
+	return nil
+}
+
+// Close - Stops watching, safe to call more than once
+func (w *Watcher[T]) Close() error {
+	var err error
+
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		err = w.fsw.Close()
+		<-w.done
+	})
+
+	return err
+}
+
+func (w *Watcher[T]) load() (*T, Sources, error) {
+	config, sources, err := load[T](w.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if w.watchOpts.Validate != nil {
+		if err := w.watchOpts.Validate(config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return config, sources, nil
+}
+
+func (w *Watcher[T]) run() {
+	defer close(w.done)
+
+	timer := time.NewTimer(w.watchOpts.Debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if w.opts.isConfigFile(event.Name) || filepath.Base(event.Name) == KUBERNETES_DATA_LINK {
+				timer.Reset(w.watchOpts.Debounce)
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.watchOpts.OnError(err)
+		case <-timer.C:
+			w.Reload()
+		}
+	}
+}
+
+// watchDirs - Search paths and directories of absolute file names that exist
+func (o LoadOpts) watchDirs() []string {
+	seen := map[string]bool{}
+	dirs := []string{}
+
+	candidates := append([]string{}, o.SearchPaths...)
+	for _, file := range []string{o.ConfigFile, o.LocalFile} {
+		if filepath.IsAbs(file) {
+			candidates = append(candidates, filepath.Dir(file))
+		}
+	}
+
+	for _, dir := range candidates {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+
+	return dirs
+}
+
+// isConfigFile - Whether path is the base, local or any profile file
+func (o LoadOpts) isConfigFile(path string) bool {
+	name := filepath.Base(path)
+
+	if name == filepath.Base(o.ConfigFile) || name == filepath.Base(o.LocalFile) {
+		return true
+	}
+
+	matched, _ := filepath.Match(withSuffix(filepath.Base(o.ConfigFile), "*"), name)
+	return matched
+}
+
+func (o WatchOpts[T]) withDefaults() WatchOpts[T] {
+	if o.Debounce <= 0 {
+		o.Debounce = DEFAULT_RELOAD_DEBOUNCE
+	}
+
+	if o.OnError == nil {
+		o.OnError = func(err error) {
+			log.Err(err).Msg("config watcher")
+		}
+	}
+
+	return o
+}
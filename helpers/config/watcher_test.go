@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watcherTestConfig struct {
+	LogLevel string `env:"WATCHER_TEST_LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	Feature  bool   `env:"WATCHER_TEST_FEATURE"`
+}
+
+func newTestWatcher(t *testing.T, dir string, watchOpts WatchOpts[watcherTestConfig]) *Watcher[watcherTestConfig] {
+	t.Helper()
+
+	w, err := NewWatcher[watcherTestConfig](LoadOpts{SearchPaths: []string{dir}, Profile: "testing"}, watchOpts)
+	assert.Nil(t, err)
+	t.Cleanup(func() { w.Close() })
+
+	return w
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: info\n"})
+
+	errs := make(chan error, 10)
+	w := newTestWatcher(t, dir, WatchOpts[watcherTestConfig]{
+		Debounce: 10 * time.Millisecond,
+		OnError:  func(err error) { errs <- err },
+	})
+	assert.Equal(t, "info", w.Current().LogLevel)
+
+	levels := make(chan [2]string, 10)
+	SubscribeValue(w, func(c *watcherTestConfig) string { return c.LogLevel }, func(old, new string) {
+		levels <- [2]string{old, new}
+	})
+
+	features := 0
+	unsubscribe := SubscribeValue(w, func(c *watcherTestConfig) bool { return c.Feature }, func(old, new bool) {
+		features++
+	})
+
+	// Editors save by replacing the file
+	tmp := filepath.Join(dir, ".env.yml.tmp")
+	assert.Nil(t, os.WriteFile(tmp, []byte("watcher_test_log_level: debug\n"), 0o600))
+	assert.Nil(t, os.Rename(tmp, filepath.Join(dir, ".env.yml")))
+
+	select {
+	case change := <-levels:
+		assert.Equal(t, [2]string{"info", "debug"}, change)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the file changed")
+	}
+	assert.Equal(t, "debug", w.Current().LogLevel)
+	assert.Equal(t, 0, features)
+
+	// Invalid values are rejected and the current config stays
+	writeFiles(t, dir, map[string]string{".env.testing.yml": "watcher_test_log_level: verbose\n"})
+
+	select {
+	case err := <-errs:
+		var problems Errors
+		assert.True(t, errors.As(err, &problems))
+		assert.Equal(t, "WATCHER_TEST_LOG_LEVEL", problems[0].Key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid reload was not reported")
+	}
+	assert.Equal(t, "debug", w.Current().LogLevel)
+
+	unsubscribe()
+	writeFiles(t, dir, map[string]string{".env.testing.yml": "watcher_test_feature: true\n"})
+	assert.Nil(t, w.Reload())
+	assert.True(t, w.Current().Feature)
+	assert.Equal(t, 0, features)
+}
+
+func TestWatcherValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: warn\n"})
+
+	rejected := errors.New("debug logging is not allowed here")
+	w := newTestWatcher(t, dir, WatchOpts[watcherTestConfig]{
+		// Reloads are triggered by hand here
+		Debounce: time.Hour,
+		Validate: func(c *watcherTestConfig) error {
+			if c.LogLevel == "debug" {
+				return rejected
+			}
+			return nil
+		},
+		OnError: func(err error) {},
+	})
+
+	calls := 0
+	w.Subscribe(func(old, new *watcherTestConfig) { calls++ })
+
+	writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: debug\n"})
+	assert.ErrorIs(t, w.Reload(), rejected)
+	assert.Equal(t, "warn", w.Current().LogLevel)
+	assert.Equal(t, 0, calls)
+
+	writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: error\n"})
+	assert.Nil(t, w.Reload())
+	assert.Equal(t, "error", w.Current().LogLevel)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, SOURCE_FILE, w.Sources()["WATCHER_TEST_LOG_LEVEL"].Kind)
+
+	assert.Nil(t, w.Close())
+	assert.Nil(t, w.Close())
+}
+
+func TestWatcherReentrantReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: info\n"})
+
+	w := newTestWatcher(t, dir, WatchOpts[watcherTestConfig]{Debounce: time.Hour})
+
+	retried := 0
+	unsubscribe := w.Subscribe(func(old, new *watcherTestConfig) {
+		// e.g. retrying once a dependency reconnected
+		if retried == 0 {
+			retried++
+			assert.Nil(t, w.Reload())
+		}
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- w.Reload() }()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+		assert.Equal(t, 1, retried)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload from a subscriber deadlocked")
+	}
+	unsubscribe()
+
+	t.Run("A slow subscriber does not block reloads", func(t *testing.T) {
+		blocked, release := make(chan struct{}), make(chan struct{})
+		var first atomic.Bool
+		unsubscribe := w.Subscribe(func(old, new *watcherTestConfig) {
+			if first.CompareAndSwap(false, true) {
+				close(blocked)
+				<-release
+			}
+		})
+		defer unsubscribe()
+
+		go w.Reload()
+		<-blocked
+
+		writeFiles(t, dir, map[string]string{".env.yml": "watcher_test_log_level: warn\n"})
+		go func() { done <- w.Reload() }()
+
+		select {
+		case err := <-done:
+			assert.Nil(t, err)
+			assert.Equal(t, "warn", w.Current().LogLevel)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Reload waited on a slow subscriber")
+		}
+
+		close(release)
+	})
+}
+
+func TestWatcherKubernetesSwap(t *testing.T) {
+	dir := t.TempDir()
+
+	// The layout kubelet gives a mounted ConfigMap
+	version := func(name string, contents string) {
+		assert.Nil(t, os.Mkdir(filepath.Join(dir, name), 0o755))
+		writeFiles(t, filepath.Join(dir, name), map[string]string{".env.yml": contents})
+	}
+	version("..2024_06_01_12_00_00.1", "watcher_test_log_level: info\n")
+	assert.Nil(t, os.Symlink("..2024_06_01_12_00_00.1", filepath.Join(dir, KUBERNETES_DATA_LINK)))
+	assert.Nil(t, os.Symlink(filepath.Join(KUBERNETES_DATA_LINK, ".env.yml"), filepath.Join(dir, ".env.yml")))
+
+	w := newTestWatcher(t, dir, WatchOpts[watcherTestConfig]{Debounce: 10 * time.Millisecond})
+	assert.Equal(t, "info", w.Current().LogLevel)
+
+	reloaded := make(chan string, 10)
+	w.Subscribe(func(old, new *watcherTestConfig) { reloaded <- new.LogLevel })
+
+	// An update writes a new version and swaps ..data over to it
+	version("..2024_06_01_12_05_00.2", "watcher_test_log_level: warn\n")
+	tmp := filepath.Join(dir, "..data_tmp")
+	assert.Nil(t, os.Symlink("..2024_06_01_12_05_00.2", tmp))
+	assert.Nil(t, os.Rename(tmp, filepath.Join(dir, KUBERNETES_DATA_LINK)))
+
+	select {
+	case level := <-reloaded:
+		assert.Equal(t, "warn", level)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the ConfigMap was updated")
+	}
+}
+
+func TestIsConfigFile(t *testing.T) {
+	opts := LoadOpts{}.withDefaults()
+
+	assert.True(t, opts.isConfigFile("/app/.env.yml"))
+	assert.True(t, opts.isConfigFile("/app/.env.local.yml"))
+	assert.True(t, opts.isConfigFile("/app/.env.production.yml"))
+	assert.False(t, opts.isConfigFile("/app/.env.yml.tmp"))
+	assert.False(t, opts.isConfigFile("/app/main.go"))
+}
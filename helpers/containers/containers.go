@@ -0,0 +1,527 @@
+package containers
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	DEFAULT_STARTUP_TIMEOUT = time.Minute
+	DEFAULT_STOP_TIMEOUT    = 30 * time.Second
+
+	// LABEL_MANAGED is set on every container started by this package so
+	// leftovers can be listed with `docker ps --filter label=...`
+	LABEL_MANAGED = "hq.litestack.lgst-common.managed"
+)
+
+// TB - The part of testing.TB log streaming needs
+type TB interface {
+	Helper()
+	Logf(format string, args ...any)
+	Cleanup(fn func())
+}
+
+// ContainerSpec - Everything needed to start a container and tell when it is ready
+type ContainerSpec struct {
+	Image string
+	Cmd   []string
+	Env   map[string]string
+	// Ports to publish, e.g. "6379/tcp". A host port can be pinned with
+	// HostPorts, otherwise Docker picks a free one.
+	Ports     []string
+	HostPorts map[string]int
+	// HostIP the ports are published on, defaults to 127.0.0.1
+	HostIP string
+	Mounts []mount.Mount
+	// Tmpfs mounts, keyed by container path, e.g. {"/data": "rw"}
+	Tmpfs map[string]string
+	// Files are copied into the container before it starts, keyed by
+	// absolute container path
+	Files  map[string]string
+	Labels map[string]string
+	// WaitingFor decides when Start returns, nil returns as soon as the
+	// container runs
+	WaitingFor WaitStrategy
+	// StartupTimeout bounds WaitingFor, defaults to DEFAULT_STARTUP_TIMEOUT
+	StartupTimeout time.Duration
+	// SkipPullIfPresent only pulls when the image is not available locally
+	SkipPullIfPresent bool
+	// Reuse picks up a running container started from an identical spec, by
+	// this or an earlier run, and keeps it running afterwards. Data written
+	// to it survives between runs while it runs, a stopped one is replaced.
+	// Also turned on by REUSE_ENV, and turns on reaping, see Reap.
+	Reuse bool
+}
+
+// Container - A container started by Start. Stop removes it.
+type Container struct {
+	ID   string
+	Spec ContainerSpec
+	// Host the published ports are reachable on
+	Host string
+	// Env is where the daemon was found to run when the container started
+	Env Environment
+	// Reused containers are shared with other runs, Stop leaves them running
+	Reused bool
+	cli    *client.Client
+	// networks this process is attached to, by name, when it runs in a
+	// container of the same daemon
+	ownNetworks map[string]string
+}
+
+// Start - Pulls the image if needed, creates the container, copies the files,
+// starts it and waits until spec.WaitingFor reports it ready. The container
+// is removed again when anything after its creation fails.
+//
+// With spec.Reuse a running container started from an identical spec is
+// picked up instead, and left running by Stop.
+func Start(ctx context.Context, cli *client.Client, spec ContainerSpec) (*Container, error) {
+	spec = spec.withDefaults()
+
+	reapInBackground(cli, spec)
+
+	env, err := DetectEnvironment(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	spec.HostIP = env.PublishIP(spec.HostIP)
+
+	hash, err := spec.ConfigHash()
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Reuse {
+		c, err := startReusable(ctx, cli, spec, hash, env)
+		if c != nil || err != nil {
+			return c, err
+		}
+	}
+
+	if err := EnsureImage(ctx, cli, spec.Image, spec.SkipPullIfPresent); err != nil {
+		return nil, err
+	}
+
+	config, hostConfig, err := spec.dockerConfig(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	if spec.Reuse {
+		// A fixed name makes concurrent test binaries race on creation
+		// instead of each starting a container of their own
+		name = reuseName(hash)
+	}
+
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	for spec.Reuse && errdefs.IsConflict(err) {
+		c, awaitErr := awaitReusable(ctx, cli, spec, hash, env)
+		if c != nil || awaitErr != nil {
+			return c, awaitErr
+		}
+
+		// The stopped holder of the name is gone
+		resp, err = cli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := newContainer(ctx, cli, resp.ID, spec, env)
+	c.Reused = spec.Reuse
+
+	if err := c.start(ctx); err != nil {
+		removeErr := cli.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+		return nil, errors.Join(err, removeErr)
+	}
+
+	return c, nil
+}
+
+func newContainer(ctx context.Context, cli *client.Client, id string, spec ContainerSpec, env Environment) *Container {
+	c := &Container{
+		ID:   id,
+		Spec: spec,
+		Host: env.Host,
+		Env:  env,
+		cli:  cli,
+	}
+
+	// Ports published on one interface of this machine are reached there
+	if !env.Remote && !env.InContainer && spec.HostIP != "0.0.0.0" {
+		c.Host = spec.HostIP
+	}
+
+	if env.InContainer && !env.Remote {
+		c.ownNetworks = ownNetworks(ctx, cli)
+	}
+
+	return c
+}
+
+func startReusable(ctx context.Context, cli *client.Client, spec ContainerSpec, hash string, env Environment) (*Container, error) {
+	id, err := findReusable(ctx, cli, hash)
+	if id == "" || err != nil {
+		return nil, err
+	}
+
+	c := newContainer(ctx, cli, id, spec, env)
+	c.Reused = true
+	slog.Info("reusing container", slog.String("container-id", c.ID), slog.String("image", spec.Image))
+
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Container) start(ctx context.Context) error {
+	for dir, files := range filesByDir(c.Spec.Files) {
+		archive, err := TarFiles(files)
+		if err != nil {
+			return err
+		}
+
+		if err := c.cli.CopyToContainer(ctx, c.ID, dir, archive, types.CopyToContainerOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.cli.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+		return err
+	}
+
+	return c.wait(ctx)
+}
+
+func (c *Container) wait(ctx context.Context) error {
+	if c.Spec.WaitingFor == nil {
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, c.Spec.StartupTimeout)
+	defer cancel()
+
+	if err := c.Spec.WaitingFor.WaitUntilReady(waitCtx, c); err != nil {
+		return fmt.Errorf("container %s (%s) not ready: %w", c.ID[:12], c.Spec.Image, err)
+	}
+
+	return nil
+}
+
+// MappedPort - Host port a container port such as "5432/tcp" is published on
+func (c *Container) MappedPort(ctx context.Context, port string) (int, error) {
+	info, err := c.cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	if info.NetworkSettings == nil {
+		return 0, fmt.Errorf("container %s has no network settings", c.ID)
+	}
+
+	for _, binding := range info.NetworkSettings.Ports[nat.Port(port)] {
+		if binding.HostPort != "" {
+			return strconv.Atoi(binding.HostPort)
+		}
+	}
+
+	return 0, fmt.Errorf("port %s of container %s is not published", port, c.ID)
+}
+
+// Connection - Where a container port is reachable from this process. From
+// a container on a shared network that is the container's IP, otherwise the
+// published port on Host.
+func (c *Container) Connection(ctx context.Context, port string) (ConnectionInfo, error) {
+	if len(c.ownNetworks) > 0 {
+		info, err := c.cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return ConnectionInfo{}, err
+		}
+
+		if network, ip, ok := sharedNetwork(c.ownNetworks, networkIPs(info.NetworkSettings)); ok {
+			return ConnectionInfo{Host: ip, Port: nat.Port(port).Int(), Network: network}, nil
+		}
+	}
+
+	mapped, err := c.MappedPort(ctx, port)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	return ConnectionInfo{Host: c.Host, Port: mapped}, nil
+}
+
+// Endpoint - host:port a container port is reachable on, see Connection
+func (c *Container) Endpoint(ctx context.Context, port string) (string, error) {
+	conn, err := c.Connection(ctx, port)
+	if err != nil {
+		return "", err
+	}
+	return conn.Address(), nil
+}
+
+// Logs - Combined stdout and stderr, following new output when follow is set
+func (c *Container) Logs(ctx context.Context, follow bool) (io.ReadCloser, error) {
+	logs, err := c.cli.ContainerLogs(ctx, c.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a TTY Docker multiplexes both streams into one
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, logs)
+		logs.Close()
+		writer.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
+
+// Exec - Runs cmd in the container and returns its exit code and output
+func (c *Container) Exec(ctx context.Context, cmd []string) (int, string, error) {
+	exec, err := c.cli.ContainerExecCreate(ctx, c.ID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	attached, err := c.cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, "", err
+	}
+	defer attached.Close()
+
+	output := &bytes.Buffer{}
+	if _, err := stdcopy.StdCopy(output, output, attached.Reader); err != nil {
+		return 0, "", err
+	}
+
+	inspect, err := c.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return inspect.ExitCode, output.String(), nil
+}
+
+// StreamLogs - Sends every log line of the container to tb.Logf until tb is done
+func (c *Container) StreamLogs(tb TB) {
+	tb.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	logs, err := c.Logs(ctx, true)
+	if err != nil {
+		cancel()
+		tb.Logf("containers: failed to stream logs of %s: %v", c.ID, err)
+		return
+	}
+
+	go func() {
+		defer close(done)
+		defer logs.Close()
+
+		prefix := fmt.Sprintf("[%s] ", c.Spec.Image)
+		scanner := bufio.NewScanner(logs)
+		for scanner.Scan() {
+			tb.Logf("%s%s", prefix, scanner.Text())
+		}
+	}()
+
+	// Logging after the test ends panics, so the stream must stop first
+	tb.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// Stop - Stops the container, which removes it, unless it is Reused
+func (c *Container) Stop(ctx context.Context) error {
+	if c.Reused {
+		return nil
+	}
+	return StopContainer(ctx, c.cli, c.ID)
+}
+
+func PullImage(ctx context.Context, cli *client.Client, imageName string) error {
+	slog.Info("pulling docker image", slog.String("image-name", imageName))
+	out, err := cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	io.Copy(os.Stdout, out)
+	return nil
+}
+
+// EnsureImage - Pulls imageName unless skipIfPresent is set and it is already local
+func EnsureImage(ctx context.Context, cli *client.Client, imageName string, skipIfPresent bool) error {
+	if skipIfPresent {
+		if _, _, err := cli.ImageInspectWithRaw(ctx, imageName); err == nil {
+			slog.Info("using local docker image", slog.String("image-name", imageName))
+			return nil
+		}
+	}
+
+	return PullImage(ctx, cli, imageName)
+}
+
+func StopContainer(ctx context.Context, cli *client.Client, id string) error {
+	timeOut := int(DEFAULT_STOP_TIMEOUT.Seconds())
+	stopOptions := container.StopOptions{
+		Timeout: &timeOut,
+	}
+	return cli.ContainerStop(ctx, id, stopOptions)
+}
+
+func (s ContainerSpec) withDefaults() ContainerSpec {
+	if s.HostIP == "" {
+		s.HostIP = "127.0.0.1"
+	}
+
+	if s.StartupTimeout <= 0 {
+		s.StartupTimeout = DEFAULT_STARTUP_TIMEOUT
+	}
+
+	if os.Getenv(REUSE_ENV) == "true" {
+		s.Reuse = true
+	}
+
+	return s
+}
+
+func (s ContainerSpec) dockerConfig(hash string) (*container.Config, *container.HostConfig, error) {
+	labels := map[string]string{LABEL_MANAGED: "true"}
+	for key, value := range session.labels() {
+		labels[key] = value
+	}
+	for key, value := range s.Labels {
+		labels[key] = value
+	}
+
+	labels[LABEL_CONFIG_HASH] = hash
+	if s.Reuse {
+		labels[LABEL_REUSE] = "true"
+	}
+
+	env := make([]string, 0, len(s.Env))
+	for key, value := range s.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+
+	exposed := nat.PortSet{}
+	bindings := nat.PortMap{}
+
+	for _, port := range s.Ports {
+		natPort, err := nat.NewPort(nat.SplitProtoPort(port))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hostPort := ""
+		if pinned, ok := s.HostPorts[port]; ok {
+			hostPort = strconv.Itoa(pinned)
+		}
+
+		exposed[natPort] = struct{}{}
+		bindings[natPort] = []nat.PortBinding{{HostIP: s.HostIP, HostPort: hostPort}}
+	}
+
+	config := &container.Config{
+		Image:        s.Image,
+		Cmd:          s.Cmd,
+		Env:          env,
+		ExposedPorts: exposed,
+		Labels:       labels,
+	}
+
+	hostConfig := &container.HostConfig{
+		AutoRemove:   !s.Reuse,
+		PortBindings: bindings,
+		Mounts:       s.Mounts,
+		Tmpfs:        s.Tmpfs,
+	}
+
+	return config, hostConfig, nil
+}
+
+// filesByDir - Groups files keyed by absolute path into one archive per directory
+func filesByDir(files map[string]string) map[string]map[string]string {
+	dirs := map[string]map[string]string{}
+
+	for file, contents := range files {
+		dir, name := path.Split(path.Clean(file))
+		if dirs[dir] == nil {
+			dirs[dir] = map[string]string{}
+		}
+		dirs[dir][name] = contents
+	}
+
+	return dirs
+}
+
+// TarFiles - Tar archive of files keyed by name, as CopyToContainer expects
+func TarFiles(files map[string]string) (io.Reader, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		header := &tar.Header{
+			Name: name,
+			Mode: 0o644,
+			Size: int64(len(files[name])),
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,88 @@
+package containers
+
+import (
+	"archive/tar"
+	"io"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerConfig(t *testing.T) {
+	spec := ContainerSpec{
+		Image:     "redis:7-alpine",
+		Env:       map[string]string{"B": "2", "A": "1"},
+		Ports:     []string{"6379/tcp", "8080"},
+		HostPorts: map[string]int{"8080": 18080},
+		Labels:    map[string]string{"suite": "cache"},
+	}.withDefaults()
+
+	config, hostConfig, err := spec.dockerConfig("abc")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"A=1", "B=2"}, config.Env)
+	assert.Equal(t, "true", config.Labels[LABEL_MANAGED])
+	assert.Equal(t, "cache", config.Labels["suite"])
+	assert.Equal(t, "abc", config.Labels[LABEL_CONFIG_HASH])
+	assert.Equal(t, SessionID(), config.Labels[LABEL_SESSION])
+	assert.NotContains(t, config.Labels, LABEL_REUSE)
+	assert.Contains(t, config.ExposedPorts, nat.Port("6379/tcp"))
+	assert.Contains(t, config.ExposedPorts, nat.Port("8080/tcp"))
+
+	assert.Equal(t, []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: ""}}, hostConfig.PortBindings["6379/tcp"])
+	assert.Equal(t, []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: "18080"}}, hostConfig.PortBindings["8080/tcp"])
+	assert.True(t, hostConfig.AutoRemove)
+
+	_, _, err = ContainerSpec{Ports: []string{"not-a-port/tcp"}}.dockerConfig("abc")
+	assert.NotNil(t, err)
+}
+
+func TestSpecDefaults(t *testing.T) {
+	t.Setenv(REUSE_ENV, "")
+
+	spec := ContainerSpec{}.withDefaults()
+	assert.Equal(t, "127.0.0.1", spec.HostIP)
+	assert.Equal(t, DEFAULT_STARTUP_TIMEOUT, spec.StartupTimeout)
+	assert.False(t, spec.Reuse)
+
+	t.Setenv(REUSE_ENV, "true")
+	assert.True(t, ContainerSpec{}.withDefaults().Reuse)
+}
+
+func TestFilesByDir(t *testing.T) {
+	dirs := filesByDir(map[string]string{
+		"/docker-entrypoint-initdb.d/01.sql": "a",
+		"/docker-entrypoint-initdb.d/02.sql": "b",
+		"/etc/redis/redis.conf":              "c",
+	})
+
+	assert.Equal(t, map[string]map[string]string{
+		"/docker-entrypoint-initdb.d/": {"01.sql": "a", "02.sql": "b"},
+		"/etc/redis/":                  {"redis.conf": "c"},
+	}, dirs)
+}
+
+func TestTarFiles(t *testing.T) {
+	archive, err := TarFiles(map[string]string{
+		"01_extensions.sql": "CREATE EXTENSION IF NOT EXISTS citext;",
+		"02_roles.sql":      "CREATE ROLE readonly;",
+	})
+	assert.Nil(t, err)
+
+	tr := tar.NewReader(archive)
+
+	header, err := tr.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "01_extensions.sql", header.Name)
+
+	contents, _ := io.ReadAll(tr)
+	assert.Equal(t, "CREATE EXTENSION IF NOT EXISTS citext;", string(contents))
+
+	header, err = tr.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "02_roles.sql", header.Name)
+
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,251 @@
+package containers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+const (
+	DOCKER_DESKTOP_HOST = "host.docker.internal"
+	PODMAN_HOST         = "host.containers.internal"
+	// DEFAULT_BRIDGE_GATEWAY is the usual gateway of Docker's default bridge,
+	// used when the routing table cannot be read
+	DEFAULT_BRIDGE_GATEWAY = "172.17.0.1"
+)
+
+// Environment - Where the daemon runs relative to this process, which
+// decides how published ports are reached
+type Environment struct {
+	// DaemonHost is the daemon address the client talks to, e.g.
+	// unix:///var/run/docker.sock or tcp://docker:2375
+	DaemonHost string
+	// Remote is set when DaemonHost points at another machine, as with
+	// docker-in-docker services in CI
+	Remote bool
+	// InContainer is set when this process runs inside a container
+	InContainer   bool
+	DockerDesktop bool
+	Rootless      bool
+	Podman        bool
+	// Host published ports are reachable on from this process
+	Host string
+}
+
+// ConnectionInfo - Where a container port is reachable from this process
+type ConnectionInfo struct {
+	Host string
+	Port int
+	// Network is set when Host is the container's own IP on a network this
+	// process is attached to as well, Port is then the container port
+	Network string
+}
+
+func (c ConnectionInfo) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// DetectEnvironment - Inspects DOCKER_HOST, the daemon and the filesystem to
+// tell how containers started through cli are reached
+func DetectEnvironment(ctx context.Context, cli *client.Client) (Environment, error) {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return Environment{}, err
+	}
+
+	return detectEnvironment(cli.DaemonHost(), info, os.DirFS("/"))
+}
+
+func detectEnvironment(daemonHost string, info system.Info, root fs.FS) (Environment, error) {
+	host, remote, err := parseDaemonHost(daemonHost)
+	if err != nil {
+		return Environment{}, err
+	}
+
+	env := Environment{
+		DaemonHost:    daemonHost,
+		Remote:        remote,
+		InContainer:   inContainer(root),
+		DockerDesktop: info.Name == "docker-desktop" || strings.Contains(info.OperatingSystem, "Docker Desktop"),
+		Rootless:      strings.Contains(daemonHost, "/run/user/"),
+		Podman:        strings.Contains(daemonHost, "podman"),
+	}
+
+	for _, option := range info.SecurityOptions {
+		if strings.Contains(option, "name=rootless") {
+			env.Rootless = true
+		}
+	}
+
+	switch {
+	case env.Remote:
+		env.Host = host
+	case !env.InContainer:
+		env.Host = "127.0.0.1"
+	case env.DockerDesktop:
+		env.Host = DOCKER_DESKTOP_HOST
+	case env.Podman:
+		env.Host = PODMAN_HOST
+	default:
+		// The daemon is on the host, which the default route leads to
+		env.Host = defaultGateway(root)
+	}
+
+	return env, nil
+}
+
+// PublishIP - Host interface ports should be published on. Loopback is only
+// reachable when this process shares the daemon's network namespace.
+func (e Environment) PublishIP(requested string) string {
+	if e.Remote || e.InContainer {
+		return "0.0.0.0"
+	}
+	return requested
+}
+
+// parseDaemonHost - Hostname of a daemon reached over the network, and
+// whether that is another machine
+func parseDaemonHost(daemonHost string) (string, bool, error) {
+	if daemonHost == "" {
+		return "", false, nil
+	}
+
+	u, err := url.Parse(daemonHost)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid docker host %q: %w", daemonHost, err)
+	}
+
+	switch u.Scheme {
+	case "unix", "npipe", "fd":
+		return "", false, nil
+	case "tcp", "http", "https", "ssh":
+		host := u.Hostname()
+		if host == "" {
+			return "", false, fmt.Errorf("docker host %q has no hostname", daemonHost)
+		}
+
+		ip := net.ParseIP(host)
+		if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return "", false, nil
+		}
+
+		return host, true, nil
+	default:
+		return "", false, fmt.Errorf("docker host %q has unsupported scheme %q", daemonHost, u.Scheme)
+	}
+}
+
+// inContainer - Docker creates /.dockerenv, Podman /run/.containerenv, and
+// anything else shows up in the cgroup of pid 1
+func inContainer(root fs.FS) bool {
+	for _, marker := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := fs.Stat(root, marker); err == nil {
+			return true
+		}
+	}
+
+	cgroup, err := fs.ReadFile(root, "proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+
+	for _, name := range []string{"docker", "kubepods", "containerd", "libpod"} {
+		if strings.Contains(string(cgroup), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultGateway - Gateway of the default route in /proc/net/route, whose
+// addresses are little endian hex
+func defaultGateway(root fs.FS) string {
+	file, err := root.Open("proc/net/route")
+	if err != nil {
+		return DEFAULT_BRIDGE_GATEWAY
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		gateway, err := hex.DecodeString(fields[2])
+		if err != nil || len(gateway) != 4 {
+			continue
+		}
+
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(gateway))
+		return ip.String()
+	}
+
+	return DEFAULT_BRIDGE_GATEWAY
+}
+
+// sharedNetwork - First network, by name, both containers are attached to,
+// with the target's IP on it
+func sharedNetwork(own map[string]string, target map[string]string) (string, string, bool) {
+	names := make([]string, 0, len(target))
+	for name := range target {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := own[name]; ok && target[name] != "" {
+			return name, target[name], true
+		}
+	}
+
+	return "", "", false
+}
+
+// ownNetworks - Networks of the container this process runs in, found by
+// its hostname, which Docker sets to the container id. Empty when the
+// daemon does not know it, e.g. a remote one.
+func ownNetworks(ctx context.Context, cli *client.Client) map[string]string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil
+	}
+
+	info, err := cli.ContainerInspect(ctx, hostname)
+	if err != nil {
+		return nil
+	}
+
+	return networkIPs(info.NetworkSettings)
+}
+
+func networkIPs(settings *types.NetworkSettings) map[string]string {
+	ips := map[string]string{}
+	if settings == nil {
+		return ips
+	}
+
+	for name, endpoint := range settings.Networks {
+		if endpoint != nil {
+			ips[name] = endpoint.IPAddress
+		}
+	}
+
+	return ips
+}
@@ -0,0 +1,158 @@
+package containers
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/docker/docker/api/types/system"
+	"github.com/stretchr/testify/assert"
+)
+
+// Default route through 172.18.0.1 on eth0, as in a compose network
+const routeTable = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	010012AC	0003	0	0	0	00000000	0	0	0
+eth0	000012AC	00000000	0001	0	0	0	0000FFFF	0	0	0
+`
+
+func TestParseDaemonHost(t *testing.T) {
+	cases := []struct {
+		daemonHost string
+		host       string
+		remote     bool
+	}{
+		{"", "", false},
+		{"unix:///var/run/docker.sock", "", false},
+		{"unix:///run/user/1000/podman/podman.sock", "", false},
+		{"npipe:////./pipe/docker_engine", "", false},
+		{"tcp://localhost:2375", "", false},
+		{"tcp://127.0.0.1:2375", "", false},
+		{"tcp://docker:2376", "docker", true},
+		{"tcp://10.0.3.7:2375", "10.0.3.7", true},
+		{"ssh://deploy@build-box", "build-box", true},
+	}
+
+	for _, c := range cases {
+		host, remote, err := parseDaemonHost(c.daemonHost)
+		assert.Nil(t, err, c.daemonHost)
+		assert.Equal(t, c.host, host, c.daemonHost)
+		assert.Equal(t, c.remote, remote, c.daemonHost)
+	}
+
+	_, _, err := parseDaemonHost("ftp://docker")
+	assert.ErrorContains(t, err, "unsupported scheme")
+
+	_, _, err = parseDaemonHost("tcp://:2375")
+	assert.ErrorContains(t, err, "no hostname")
+}
+
+func TestInContainer(t *testing.T) {
+	assert.False(t, inContainer(fstest.MapFS{}))
+	assert.True(t, inContainer(fstest.MapFS{".dockerenv": {}}))
+	assert.True(t, inContainer(fstest.MapFS{"run/.containerenv": {}}))
+	assert.True(t, inContainer(fstest.MapFS{
+		"proc/1/cgroup": {Data: []byte("0::/kubepods/besteffort/pod1234/abcd\n")},
+	}))
+	assert.False(t, inContainer(fstest.MapFS{
+		"proc/1/cgroup": {Data: []byte("0::/init.scope\n")},
+	}))
+}
+
+func TestDefaultGateway(t *testing.T) {
+	assert.Equal(t, "172.18.0.1", defaultGateway(fstest.MapFS{"proc/net/route": {Data: []byte(routeTable)}}))
+	assert.Equal(t, DEFAULT_BRIDGE_GATEWAY, defaultGateway(fstest.MapFS{}))
+}
+
+func TestDetectEnvironment(t *testing.T) {
+	container := fstest.MapFS{
+		".dockerenv":     {},
+		"proc/net/route": {Data: []byte(routeTable)},
+	}
+
+	cases := []struct {
+		name       string
+		daemonHost string
+		info       system.Info
+		root       fstest.MapFS
+		expected   Environment
+	}{
+		{
+			name:       "local daemon",
+			daemonHost: "unix:///var/run/docker.sock",
+			root:       fstest.MapFS{},
+			expected:   Environment{Host: "127.0.0.1"},
+		},
+		{
+			name:       "docker in docker",
+			daemonHost: "tcp://docker:2375",
+			root:       container,
+			expected:   Environment{Remote: true, InContainer: true, Host: "docker"},
+		},
+		{
+			name:       "socket mounted into a container",
+			daemonHost: "unix:///var/run/docker.sock",
+			root:       container,
+			expected:   Environment{InContainer: true, Host: "172.18.0.1"},
+		},
+		{
+			name:       "docker desktop dev container",
+			daemonHost: "unix:///var/run/docker.sock",
+			info:       system.Info{Name: "docker-desktop"},
+			root:       container,
+			expected:   Environment{InContainer: true, DockerDesktop: true, Host: DOCKER_DESKTOP_HOST},
+		},
+		{
+			name:       "docker desktop host",
+			daemonHost: "unix:///home/dev/.docker/desktop/docker.sock",
+			info:       system.Info{OperatingSystem: "Docker Desktop"},
+			root:       fstest.MapFS{},
+			expected:   Environment{DockerDesktop: true, Host: "127.0.0.1"},
+		},
+		{
+			name:       "rootless docker",
+			daemonHost: "unix:///run/user/1000/docker.sock",
+			info:       system.Info{SecurityOptions: []string{"name=seccomp,profile=builtin", "name=rootless"}},
+			root:       fstest.MapFS{},
+			expected:   Environment{Rootless: true, Host: "127.0.0.1"},
+		},
+		{
+			name:       "podman container",
+			daemonHost: "unix:///run/podman/podman.sock",
+			root:       fstest.MapFS{"run/.containerenv": {}},
+			expected:   Environment{InContainer: true, Podman: true, Host: PODMAN_HOST},
+		},
+	}
+
+	for _, c := range cases {
+		env, err := detectEnvironment(c.daemonHost, c.info, c.root)
+		assert.Nil(t, err, c.name)
+
+		c.expected.DaemonHost = c.daemonHost
+		assert.Equal(t, c.expected, env, c.name)
+	}
+}
+
+func TestPublishIP(t *testing.T) {
+	assert.Equal(t, "127.0.0.1", Environment{}.PublishIP("127.0.0.1"))
+	assert.Equal(t, "0.0.0.0", Environment{InContainer: true}.PublishIP("127.0.0.1"))
+	assert.Equal(t, "0.0.0.0", Environment{Remote: true}.PublishIP("127.0.0.1"))
+}
+
+func TestSharedNetwork(t *testing.T) {
+	own := map[string]string{"bridge": "172.17.0.5", "ci": "10.1.0.2"}
+
+	network, ip, ok := sharedNetwork(own, map[string]string{"ci": "10.1.0.3", "db": "10.2.0.3"})
+	assert.True(t, ok)
+	assert.Equal(t, "ci", network)
+	assert.Equal(t, "10.1.0.3", ip)
+
+	_, _, ok = sharedNetwork(own, map[string]string{"db": "10.2.0.3"})
+	assert.False(t, ok)
+
+	_, _, ok = sharedNetwork(nil, map[string]string{"bridge": "172.17.0.6"})
+	assert.False(t, ok)
+}
+
+func TestConnectionInfoAddress(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:5432", ConnectionInfo{Host: "127.0.0.1", Port: 5432}.Address())
+	assert.Equal(t, "[fd00::2]:5432", ConnectionInfo{Host: "fd00::2", Port: 5432}.Address())
+}
@@ -0,0 +1,39 @@
+package containers
+
+const (
+	REDIS_IMAGE = "redis:7-alpine"
+	REDIS_PORT  = "6379/tcp"
+
+	MINIO_IMAGE        = "minio/minio:latest"
+	MINIO_PORT         = "9000/tcp"
+	MINIO_CONSOLE_PORT = "9001/tcp"
+)
+
+// Redis - Spec for a throwaway Redis without persistence
+func Redis() ContainerSpec {
+	return ContainerSpec{
+		Image: REDIS_IMAGE,
+		Cmd:   []string{"redis-server", "--save", "", "--appendonly", "no"},
+		Ports: []string{REDIS_PORT},
+		WaitingFor: ForAll(
+			ForLog("Ready to accept connections"),
+			ForExec("redis-cli", "ping"),
+		),
+	}
+}
+
+// MinIO - Spec for a throwaway S3 compatible MinIO server, with its console
+// published on MINIO_CONSOLE_PORT
+func MinIO(rootUser string, rootPassword string) ContainerSpec {
+	return ContainerSpec{
+		Image: MINIO_IMAGE,
+		Cmd:   []string{"server", "/data", "--console-address", ":9001"},
+		Env: map[string]string{
+			"MINIO_ROOT_USER":     rootUser,
+			"MINIO_ROOT_PASSWORD": rootPassword,
+		},
+		Ports:      []string{MINIO_PORT, MINIO_CONSOLE_PORT},
+		Tmpfs:      map[string]string{"/data": "rw"},
+		WaitingFor: ForHTTP(MINIO_PORT, "/minio/health/ready"),
+	}
+}
@@ -0,0 +1,21 @@
+package containers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis(t *testing.T) {
+	spec := Redis()
+	assert.Equal(t, REDIS_IMAGE, spec.Image)
+	assert.Equal(t, []string{REDIS_PORT}, spec.Ports)
+	assert.Len(t, spec.WaitingFor, 2)
+}
+
+func TestMinIO(t *testing.T) {
+	spec := MinIO("minio", "minio-secret")
+	assert.Equal(t, "minio-secret", spec.Env["MINIO_ROOT_PASSWORD"])
+	assert.Equal(t, []string{MINIO_PORT, MINIO_CONSOLE_PORT}, spec.Ports)
+	assert.Equal(t, &HTTPStrategy{Port: MINIO_PORT, Path: "/minio/health/ready", StatusCode: 200}, spec.WaitingFor)
+}
@@ -0,0 +1,162 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// DEFAULT_REAP_TTL is how old a container of a dead session must be
+	// before it is removed
+	DEFAULT_REAP_TTL = time.Hour
+	// DEFAULT_REUSE_TTL is how old a stopped reusable container must be
+	// before it is removed
+	DEFAULT_REUSE_TTL = 24 * time.Hour
+
+	// REAP_ENV set to "true" makes Start reap in the background even when
+	// the spec does not use Reuse
+	REAP_ENV = "LGST_CONTAINERS_REAP"
+)
+
+type ReapOpts struct {
+	// TTL defaults to DEFAULT_REAP_TTL
+	TTL time.Duration
+	// ReuseTTL defaults to DEFAULT_REUSE_TTL
+	ReuseTTL time.Duration
+	// OtherHosts also reaps containers started from other hosts once past
+	// TTL. Whether their session is alive cannot be checked, so this is
+	// only safe when no suite sharing the daemon runs longer than TTL.
+	OtherHosts bool
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+var reapOnce sync.Once
+
+// Reap - Removes containers labeled by this package that belong to a dead
+// session of this host and are older than opts.TTL. Reusable containers are
+// only removed once stopped and older than opts.ReuseTTL, running ones may
+// be in use by any session. Returns the ids of the removed containers.
+func Reap(ctx context.Context, cli *client.Client, opts ReapOpts) ([]string, error) {
+	opts = opts.withDefaults()
+
+	found, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LABEL_MANAGED)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	var errs []error
+
+	for _, summary := range found {
+		if !shouldReap(summary, opts) {
+			continue
+		}
+
+		if err := cli.ContainerRemove(ctx, summary.ID, container.RemoveOptions{Force: true}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		slog.Info("reaped leftover container", slog.String("container-id", summary.ID), slog.String("image", summary.Image))
+		removed = append(removed, summary.ID)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// reapInBackground - Reaps once per process, called by Start when reuse or
+// REAP_ENV opted in, so killed test runs are cleaned up by the next one
+func reapInBackground(cli *client.Client, spec ContainerSpec) {
+	if !reapEnabled(spec) {
+		return
+	}
+
+	reapOnce.Do(func() {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_STOP_TIMEOUT)
+			defer cancel()
+
+			if _, err := Reap(ctx, cli, ReapOpts{}); err != nil {
+				slog.Warn("failed to reap leftover containers", slog.String("error", err.Error()))
+			}
+		}()
+	})
+}
+
+func reapEnabled(spec ContainerSpec) bool {
+	return spec.Reuse || os.Getenv(REAP_ENV) == "true"
+}
+
+func shouldReap(summary types.Container, opts ReapOpts) bool {
+	age := opts.Now().Sub(time.Unix(summary.Created, 0))
+
+	if summary.Labels[LABEL_REUSE] == "true" {
+		// findReusable hands out running containers to any session
+		return summary.State != "running" && age > opts.ReuseTTL && !sessionAlive(summary.Labels, opts)
+	}
+
+	return age > opts.TTL && !sessionAlive(summary.Labels, opts)
+}
+
+// sessionAlive - Whether the process that started a container may still be
+// running. Sessions on other hosts cannot be checked and count as alive,
+// unless opts.OtherHosts gives up on them.
+func sessionAlive(labels map[string]string, opts ReapOpts) bool {
+	if labels[LABEL_SESSION] == session.ID {
+		return true
+	}
+
+	if labels[LABEL_SESSION_HOST] != session.Host {
+		return !opts.OtherHosts
+	}
+
+	pid, err := strconv.Atoi(labels[LABEL_SESSION_PID])
+	if err != nil {
+		return false
+	}
+
+	return processAlive(pid)
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// Signal 0 only checks the process exists. EPERM means it does but
+	// belongs to someone else.
+	err = process.Signal(syscall.Signal(0))
+	return !errors.Is(err, os.ErrProcessDone)
+}
+
+func (o ReapOpts) withDefaults() ReapOpts {
+	if o.TTL <= 0 {
+		o.TTL = DEFAULT_REAP_TTL
+	}
+
+	if o.ReuseTTL <= 0 {
+		o.ReuseTTL = DEFAULT_REUSE_TTL
+	}
+
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+
+	return o
+}
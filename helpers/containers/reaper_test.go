@@ -0,0 +1,105 @@
+package containers
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReap(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	opts := ReapOpts{TTL: time.Hour, ReuseTTL: 24 * time.Hour, Now: func() time.Time { return now }}.withDefaults()
+
+	created := func(ago time.Duration) int64 {
+		return now.Add(-ago).Unix()
+	}
+
+	deadSession := map[string]string{
+		LABEL_MANAGED:      "true",
+		LABEL_SESSION:      "dead",
+		LABEL_SESSION_HOST: session.Host,
+		// Beyond any pid_max, so never a running process
+		LABEL_SESSION_PID: "2147483647",
+	}
+
+	aliveSession := map[string]string{
+		LABEL_MANAGED:      "true",
+		LABEL_SESSION:      "alive",
+		LABEL_SESSION_HOST: session.Host,
+		LABEL_SESSION_PID:  strconv.Itoa(os.Getppid()),
+	}
+
+	otherHost := map[string]string{
+		LABEL_MANAGED:      "true",
+		LABEL_SESSION:      "elsewhere",
+		LABEL_SESSION_HOST: "ci-runner-7",
+		LABEL_SESSION_PID:  "1",
+	}
+
+	ours := session.labels()
+
+	withLabels := func(base map[string]string, extra map[string]string) map[string]string {
+		labels := map[string]string{}
+		for k, v := range base {
+			labels[k] = v
+		}
+		for k, v := range extra {
+			labels[k] = v
+		}
+		return labels
+	}
+
+	reused := withLabels(deadSession, map[string]string{LABEL_REUSE: "true"})
+	reusedAlive := withLabels(aliveSession, map[string]string{LABEL_REUSE: "true"})
+	reusedElsewhere := withLabels(otherHost, map[string]string{LABEL_REUSE: "true"})
+
+	otherHosts := opts
+	otherHosts.OtherHosts = true
+
+	cases := []struct {
+		name   string
+		labels map[string]string
+		state  string
+		age    time.Duration
+		opts   ReapOpts
+		reap   bool
+	}{
+		{"dead session past ttl", deadSession, "running", 2 * time.Hour, opts, true},
+		{"dead session within ttl", deadSession, "running", 30 * time.Minute, opts, false},
+		{"alive session past ttl", aliveSession, "running", 2 * time.Hour, opts, false},
+		{"other host past ttl", otherHost, "running", 2 * time.Hour, opts, false},
+		{"other host past ttl when opted in", otherHost, "running", 2 * time.Hour, otherHosts, true},
+		{"other host within ttl when opted in", otherHost, "running", 30 * time.Minute, otherHosts, false},
+		{"this session", ours, "running", 48 * time.Hour, opts, false},
+		{"reused within reuse ttl", reused, "exited", 2 * time.Hour, opts, false},
+		{"reused past reuse ttl", reused, "exited", 25 * time.Hour, opts, true},
+		{"reused and running", reused, "running", 25 * time.Hour, opts, false},
+		{"reused by an alive session", reusedAlive, "exited", 25 * time.Hour, opts, false},
+		{"reused from another host", reusedElsewhere, "exited", 25 * time.Hour, opts, false},
+	}
+
+	for _, c := range cases {
+		summary := types.Container{ID: c.name, Labels: c.labels, State: c.state, Created: created(c.age)}
+		assert.Equal(t, c.reap, shouldReap(summary, c.opts), c.name)
+	}
+}
+
+func TestReapEnabled(t *testing.T) {
+	t.Setenv(REAP_ENV, "")
+	assert.False(t, reapEnabled(ContainerSpec{}))
+	assert.True(t, reapEnabled(ContainerSpec{Reuse: true}))
+
+	t.Setenv(REAP_ENV, "true")
+	assert.True(t, reapEnabled(ContainerSpec{}))
+}
+
+func TestReapOptsDefaults(t *testing.T) {
+	opts := ReapOpts{}.withDefaults()
+	assert.Equal(t, DEFAULT_REAP_TTL, opts.TTL)
+	assert.Equal(t, DEFAULT_REUSE_TTL, opts.ReuseTTL)
+	assert.NotNil(t, opts.Now)
+}
@@ -0,0 +1,157 @@
+package containers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	LABEL_SESSION      = "hq.litestack.lgst-common.session"
+	LABEL_SESSION_HOST = "hq.litestack.lgst-common.session-host"
+	LABEL_SESSION_PID  = "hq.litestack.lgst-common.session-pid"
+	LABEL_REUSE        = "hq.litestack.lgst-common.reuse"
+	LABEL_CONFIG_HASH  = "hq.litestack.lgst-common.config-hash"
+
+	// REUSE_ENV set to "true" turns Reuse on for every spec, handy for
+	// local loops without touching the tests
+	REUSE_ENV         = "LGST_CONTAINERS_REUSE"
+	REUSE_NAME_PREFIX = "lgst-reuse-"
+
+	// REUSE_POLL_INTERVAL is how often a container another process is
+	// starting is checked on
+	REUSE_POLL_INTERVAL = 250 * time.Millisecond
+)
+
+// sessionInfo - Identifies the process that started a container, so the
+// reaper can tell whether it is still around
+type sessionInfo struct {
+	ID   string
+	Host string
+	PID  int
+}
+
+var session = newSession()
+
+func newSession() sessionInfo {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	host, _ := os.Hostname()
+
+	return sessionInfo{
+		ID:   hex.EncodeToString(id),
+		Host: host,
+		PID:  os.Getpid(),
+	}
+}
+
+// SessionID - Random id labeling every container this process starts
+func SessionID() string {
+	return session.ID
+}
+
+func (s sessionInfo) labels() map[string]string {
+	return map[string]string{
+		LABEL_SESSION:      s.ID,
+		LABEL_SESSION_HOST: s.Host,
+		LABEL_SESSION_PID:  strconv.Itoa(s.PID),
+	}
+}
+
+// ConfigHash - Identifies containers a spec can reuse. Host ports, timeouts
+// and wait strategies are left out, they do not change what runs inside.
+func (s ContainerSpec) ConfigHash() (string, error) {
+	encoded, err := json.Marshal(struct {
+		Image  string
+		Cmd    []string
+		Env    map[string]string
+		Ports  []string
+		HostIP string
+		Mounts []mount.Mount
+		Tmpfs  map[string]string
+		Files  map[string]string
+		Labels map[string]string
+	}{s.Image, s.Cmd, s.Env, s.Ports, s.HostIP, s.Mounts, s.Tmpfs, s.Files, s.Labels})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// findReusable - Id of a running container started from a spec with the
+// same hash, empty when there is none. Created containers may still be set
+// up by another process and stopped ones are replaced by awaitReusable.
+func findReusable(ctx context.Context, cli *client.Client, hash string) (string, error) {
+	found, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", LABEL_CONFIG_HASH+"="+hash),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(found) == 0 {
+		return "", nil
+	}
+
+	return found[0].ID, nil
+}
+
+// awaitReusable - Called when the reuse name is taken. Waits for the holder,
+// usually being started by another process, to run and picks it up. A
+// stopped holder is removed instead, nil is returned so it can be created
+// again.
+func awaitReusable(ctx context.Context, cli *client.Client, spec ContainerSpec, hash string, env Environment) (*Container, error) {
+	ctx, cancel := context.WithTimeout(ctx, spec.StartupTimeout)
+	defer cancel()
+
+	name := reuseName(hash)
+
+	for {
+		c, err := startReusable(ctx, cli, spec, hash, env)
+		if c != nil || err != nil {
+			return c, err
+		}
+
+		info, err := cli.ContainerInspect(ctx, name)
+		switch {
+		case errdefs.IsNotFound(err):
+			return nil, nil
+		case err != nil:
+			return nil, err
+		case info.State.Status == "exited" || info.State.Status == "dead":
+			err := cli.ContainerRemove(ctx, info.ID, container.RemoveOptions{Force: true})
+			if err != nil && !errdefs.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to replace stopped container %s: %w", name, err)
+			}
+			return nil, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("container %s did not start in time: %w", name, ctx.Err())
+		case <-time.After(REUSE_POLL_INTERVAL):
+		}
+	}
+}
+
+func reuseName(hash string) string {
+	return REUSE_NAME_PREFIX + hash[:12]
+}
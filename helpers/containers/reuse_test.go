@@ -0,0 +1,45 @@
+package containers
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigHash(t *testing.T) {
+	spec := Redis()
+
+	hash, err := spec.ConfigHash()
+	assert.Nil(t, err)
+	assert.Len(t, hash, 64)
+
+	// Only what runs inside the container counts
+	tuned := spec
+	tuned.HostPorts = map[string]int{REDIS_PORT: 16379}
+	tuned.StartupTimeout = time.Second
+	tuned.WaitingFor = nil
+	tuned.Reuse = true
+
+	tunedHash, _ := tuned.ConfigHash()
+	assert.Equal(t, hash, tunedHash)
+
+	changed := spec
+	changed.Env = map[string]string{"REDIS_ARGS": "--maxmemory 64mb"}
+
+	changedHash, _ := changed.ConfigHash()
+	assert.NotEqual(t, hash, changedHash)
+
+	assert.Equal(t, REUSE_NAME_PREFIX+hash[:12], reuseName(hash))
+}
+
+func TestDockerConfigReuse(t *testing.T) {
+	config, hostConfig, err := ContainerSpec{Image: "redis", Reuse: true}.dockerConfig("abc")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "true", config.Labels[LABEL_REUSE])
+	assert.Equal(t, strconv.Itoa(os.Getpid()), config.Labels[LABEL_SESSION_PID])
+	assert.False(t, hostConfig.AutoRemove)
+}
@@ -0,0 +1,193 @@
+package containers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DEFAULT_POLL_INTERVAL = 250 * time.Millisecond
+
+// Target - What wait strategies can observe of a container. *Container
+// implements it.
+type Target interface {
+	Endpoint(ctx context.Context, port string) (string, error)
+	Logs(ctx context.Context, follow bool) (io.ReadCloser, error)
+	Exec(ctx context.Context, cmd []string) (int, string, error)
+}
+
+// WaitStrategy - Blocks until the container is ready or ctx is done
+type WaitStrategy interface {
+	WaitUntilReady(ctx context.Context, target Target) error
+}
+
+// LogStrategy - Ready once Line has appeared Occurrences times in the logs
+type LogStrategy struct {
+	Line        string
+	Occurrences int
+}
+
+// PortStrategy - Ready once Port accepts TCP connections from the host
+type PortStrategy struct {
+	Port string
+}
+
+// HTTPStrategy - Ready once a GET on Path through Port answers StatusCode
+type HTTPStrategy struct {
+	Port       string
+	Path       string
+	StatusCode int
+}
+
+// ExecStrategy - Ready once Cmd exits with 0 inside the container
+type ExecStrategy struct {
+	Cmd []string
+}
+
+// AllStrategy - Ready once every strategy is, checked in order
+type AllStrategy []WaitStrategy
+
+func ForLog(line string) *LogStrategy {
+	return &LogStrategy{Line: line, Occurrences: 1}
+}
+
+// WithOccurrences - Some images log the ready line once for a temporary
+// server during init and once for the real one
+func (s *LogStrategy) WithOccurrences(n int) *LogStrategy {
+	s.Occurrences = n
+	return s
+}
+
+func ForPort(port string) *PortStrategy {
+	return &PortStrategy{Port: port}
+}
+
+func ForHTTP(port string, path string) *HTTPStrategy {
+	return &HTTPStrategy{Port: port, Path: path, StatusCode: http.StatusOK}
+}
+
+func ForExec(cmd ...string) *ExecStrategy {
+	return &ExecStrategy{Cmd: cmd}
+}
+
+func ForAll(strategies ...WaitStrategy) AllStrategy {
+	return strategies
+}
+
+func (s *LogStrategy) WaitUntilReady(ctx context.Context, target Target) error {
+	logs, err := target.Logs(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	// Closing the stream unblocks the scanner when ctx ends first
+	stop := context.AfterFunc(ctx, func() { logs.Close() })
+	defer stop()
+
+	seen := 0
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), s.Line) {
+			seen++
+		}
+		if seen >= s.Occurrences {
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("log line %q seen %d/%d times: %w", s.Line, seen, s.Occurrences, ctx.Err())
+	}
+
+	return fmt.Errorf("container logs ended after %q was seen %d/%d times", s.Line, seen, s.Occurrences)
+}
+
+func (s *PortStrategy) WaitUntilReady(ctx context.Context, target Target) error {
+	return poll(ctx, func() error {
+		endpoint, err := target.Endpoint(ctx, s.Port)
+		if err != nil {
+			return err
+		}
+
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", endpoint)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+func (s *HTTPStrategy) WaitUntilReady(ctx context.Context, target Target) error {
+	return poll(ctx, func() error {
+		endpoint, err := target.Endpoint(ctx, s.Port)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+endpoint+s.Path, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != s.StatusCode {
+			return fmt.Errorf("GET %s answered %s", s.Path, resp.Status)
+		}
+
+		return nil
+	})
+}
+
+func (s *ExecStrategy) WaitUntilReady(ctx context.Context, target Target) error {
+	return poll(ctx, func() error {
+		exitCode, output, err := target.Exec(ctx, s.Cmd)
+		if err != nil {
+			return err
+		}
+
+		if exitCode != 0 {
+			return fmt.Errorf("%s exited with %d: %s", strings.Join(s.Cmd, " "), exitCode, strings.TrimSpace(output))
+		}
+
+		return nil
+	})
+}
+
+func (s AllStrategy) WaitUntilReady(ctx context.Context, target Target) error {
+	for _, strategy := range s {
+		if err := strategy.WaitUntilReady(ctx, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poll - Calls check every DEFAULT_POLL_INTERVAL until it succeeds or ctx is done
+func poll(ctx context.Context, check func() error) error {
+	ticker := time.NewTicker(DEFAULT_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
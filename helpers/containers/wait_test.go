@@ -0,0 +1,108 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTarget struct {
+	endpoint string
+	logs     string
+	execs    atomic.Int32
+	// healthyAfter is the number of failing execs before one succeeds
+	healthyAfter int32
+}
+
+func (f *fakeTarget) Endpoint(ctx context.Context, port string) (string, error) {
+	if f.endpoint == "" {
+		return "", errors.New("not published")
+	}
+	return f.endpoint, nil
+}
+
+func (f *fakeTarget) Logs(ctx context.Context, follow bool) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(f.logs)), nil
+}
+
+func (f *fakeTarget) Exec(ctx context.Context, cmd []string) (int, string, error) {
+	if f.execs.Add(1) <= f.healthyAfter {
+		return 1, "not ready\n", nil
+	}
+	return 0, "PONG\n", nil
+}
+
+func waitCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestLogStrategy(t *testing.T) {
+	target := &fakeTarget{logs: "starting\nready to accept connections\nshutting down\nready to accept connections\n"}
+
+	assert.Nil(t, ForLog("ready to accept connections").WaitUntilReady(waitCtx(t), target))
+	assert.Nil(t, ForLog("ready to accept connections").WithOccurrences(2).WaitUntilReady(waitCtx(t), target))
+
+	err := ForLog("ready to accept connections").WithOccurrences(3).WaitUntilReady(waitCtx(t), target)
+	assert.ErrorContains(t, err, "seen 2/3 times")
+}
+
+func TestPortStrategy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	target := &fakeTarget{endpoint: listener.Addr().String()}
+	assert.Nil(t, ForPort("5432/tcp").WaitUntilReady(waitCtx(t), target))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err = ForPort("5432/tcp").WaitUntilReady(ctx, &fakeTarget{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "not published")
+}
+
+func TestHTTPStrategy(t *testing.T) {
+	var ready atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer server.Close()
+
+	target := &fakeTarget{endpoint: strings.TrimPrefix(server.URL, "http://")}
+
+	time.AfterFunc(300*time.Millisecond, func() { ready.Store(true) })
+	assert.Nil(t, ForHTTP("9000/tcp", "/health").WaitUntilReady(waitCtx(t), target))
+}
+
+func TestExecStrategy(t *testing.T) {
+	target := &fakeTarget{healthyAfter: 2}
+
+	assert.Nil(t, ForExec("redis-cli", "ping").WaitUntilReady(waitCtx(t), target))
+	assert.Equal(t, int32(3), target.execs.Load())
+}
+
+func TestAllStrategy(t *testing.T) {
+	target := &fakeTarget{logs: "Ready to accept connections\n"}
+
+	strategy := ForAll(ForLog("Ready to accept connections"), ForExec("redis-cli", "ping"))
+	assert.Nil(t, strategy.WaitUntilReady(waitCtx(t), target))
+
+	strategy = ForAll(ForLog("never logged"), ForExec("redis-cli", "ping"))
+	assert.NotNil(t, strategy.WaitUntilReady(waitCtx(t), target))
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	PG_UNIQUE_VIOLATION      pq.ErrorCode = "23505"
+	PG_FOREIGN_KEY_VIOLATION pq.ErrorCode = "23503"
+	PG_NOT_NULL_VIOLATION    pq.ErrorCode = "23502"
+	PG_CHECK_VIOLATION       pq.ErrorCode = "23514"
+	PG_SERIALIZATION_FAILURE pq.ErrorCode = "40001"
+	PG_DEADLOCK_DETECTED     pq.ErrorCode = "40P01"
+)
+
+var (
+	ErrNotFound             = errors.New("record not found")
+	ErrUniqueViolation      = errors.New("unique constraint violation")
+	ErrForeignKeyViolation  = errors.New("foreign key constraint violation")
+	ErrNotNullViolation     = errors.New("not null constraint violation")
+	ErrCheckViolation       = errors.New("check constraint violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+)
+
+var keyDetailRx = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+// ConstraintError - Typed view of a Postgres integrity or concurrency error.
+// errors.Is matches it against the sentinel in Kind, errors.As against *pq.Error.
+type ConstraintError struct {
+	Kind       error
+	Code       pq.ErrorCode
+	Table      string
+	Constraint string
+	Columns    []string
+	Detail     string
+	Err        *pq.Error
+}
+
+func (e *ConstraintError) Error() string {
+	msg := e.Kind.Error()
+
+	if e.Constraint != "" {
+		msg += fmt.Sprintf(" on %q", e.Constraint)
+	}
+
+	if len(e.Columns) > 0 {
+		msg += fmt.Sprintf(" (%s)", strings.Join(e.Columns, ", "))
+	}
+
+	return msg
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Column - First column involved in the violation, if Postgres reported any
+func (e *ConstraintError) Column() string {
+	if len(e.Columns) == 0 {
+		return ""
+	}
+	return e.Columns[0]
+}
+
+// ClassifyError - Maps sql.ErrNoRows and lib/pq errors to the typed errors of
+// this package. Errors it does not recognise are returned unchanged.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var constraintErr *ConstraintError
+	if errors.Is(err, ErrNotFound) || errors.As(err, &constraintErr) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	kind := kindFromCode(pqErr.Code)
+	if kind == nil {
+		return err
+	}
+
+	return &ConstraintError{
+		Kind:       kind,
+		Code:       pqErr.Code,
+		Table:      pqErr.Table,
+		Constraint: pqErr.Constraint,
+		Columns:    columnsFromError(pqErr),
+		Detail:     pqErr.Detail,
+		Err:        pqErr,
+	}
+}
+
+// IsRetryable - Reports whether the transaction that produced err can be retried as is
+func IsRetryable(err error) bool {
+	return errors.Is(ClassifyError(err), ErrSerializationFailure)
+}
+
+// HTTPStatus - HTTP status code that best describes err
+func HTTPStatus(err error) int {
+	err = ClassifyError(err)
+
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUniqueViolation), errors.Is(err, ErrSerializationFailure):
+		return http.StatusConflict
+	case errors.Is(err, ErrForeignKeyViolation),
+		errors.Is(err, ErrNotNullViolation),
+		errors.Is(err, ErrCheckViolation):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GraphQLCode - Value for the "code" extension of a GraphQL error describing err
+func GraphQLCode(err error) string {
+	err = ClassifyError(err)
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNotFound):
+		return "NOT_FOUND"
+	case errors.Is(err, ErrUniqueViolation):
+		return "CONFLICT"
+	case errors.Is(err, ErrSerializationFailure):
+		return "RETRYABLE"
+	case errors.Is(err, ErrForeignKeyViolation),
+		errors.Is(err, ErrNotNullViolation),
+		errors.Is(err, ErrCheckViolation):
+		return "BAD_USER_INPUT"
+	default:
+		return "INTERNAL_SERVER_ERROR"
+	}
+}
+
+func kindFromCode(code pq.ErrorCode) error {
+	switch code {
+	case PG_UNIQUE_VIOLATION:
+		return ErrUniqueViolation
+	case PG_FOREIGN_KEY_VIOLATION:
+		return ErrForeignKeyViolation
+	case PG_NOT_NULL_VIOLATION:
+		return ErrNotNullViolation
+	case PG_CHECK_VIOLATION:
+		return ErrCheckViolation
+	case PG_SERIALIZATION_FAILURE, PG_DEADLOCK_DETECTED:
+		return ErrSerializationFailure
+	}
+	return nil
+}
+
+func columnsFromError(pqErr *pq.Error) []string {
+	if pqErr.Column != "" {
+		return []string{pqErr.Column}
+	}
+
+	// Unique and foreign key violations only name the columns in the detail,
+	// e.g. `Key (email)=(john@example.com) already exists.`
+	match := keyDetailRx.FindStringSubmatch(pqErr.Detail)
+	if match == nil {
+		return nil
+	}
+
+	columns := strings.Split(match[1], ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	return columns
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Run("Unique violation", func(t *testing.T) {
+		pqErr := &pq.Error{
+			Code:       PG_UNIQUE_VIOLATION,
+			Table:      "users",
+			Constraint: "users_email_key",
+			Detail:     "Key (email)=(john@example.com) already exists.",
+		}
+
+		err := ClassifyError(fmt.Errorf("insert user: %w", pqErr))
+
+		var constraintErr *ConstraintError
+		assert.ErrorIs(t, err, ErrUniqueViolation)
+		assert.ErrorAs(t, err, &constraintErr)
+		assert.Equal(t, "users_email_key", constraintErr.Constraint)
+		assert.Equal(t, "email", constraintErr.Column())
+		assert.Equal(t, "users", constraintErr.Table)
+
+		var unwrapped *pq.Error
+		assert.ErrorAs(t, err, &unwrapped)
+	})
+
+	t.Run("Composite key", func(t *testing.T) {
+		err := ClassifyError(&pq.Error{
+			Code:   PG_UNIQUE_VIOLATION,
+			Detail: "Key (org_id, slug)=(1, home) already exists.",
+		})
+
+		var constraintErr *ConstraintError
+		assert.ErrorAs(t, err, &constraintErr)
+		assert.Equal(t, []string{"org_id", "slug"}, constraintErr.Columns)
+	})
+
+	t.Run("Other constraint violations", func(t *testing.T) {
+		assert.ErrorIs(t, ClassifyError(&pq.Error{Code: PG_FOREIGN_KEY_VIOLATION}), ErrForeignKeyViolation)
+		assert.ErrorIs(t, ClassifyError(&pq.Error{Code: PG_CHECK_VIOLATION}), ErrCheckViolation)
+		assert.ErrorIs(t, ClassifyError(&pq.Error{Code: PG_SERIALIZATION_FAILURE}), ErrSerializationFailure)
+		assert.ErrorIs(t, ClassifyError(&pq.Error{Code: PG_DEADLOCK_DETECTED}), ErrSerializationFailure)
+
+		err := ClassifyError(&pq.Error{Code: PG_NOT_NULL_VIOLATION, Column: "name"})
+		var constraintErr *ConstraintError
+		assert.ErrorIs(t, err, ErrNotNullViolation)
+		assert.ErrorAs(t, err, &constraintErr)
+		assert.Equal(t, "name", constraintErr.Column())
+	})
+
+	t.Run("No rows", func(t *testing.T) {
+		err := ClassifyError(sql.ErrNoRows)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("Unknown errors are left alone", func(t *testing.T) {
+		original := errors.New("connection refused")
+		assert.Equal(t, original, ClassifyError(original))
+		assert.Nil(t, ClassifyError(nil))
+
+		syntaxErr := &pq.Error{Code: "42601"}
+		assert.Equal(t, error(syntaxErr), ClassifyError(syntaxErr))
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(sql.ErrNoRows))
+	assert.Equal(t, http.StatusConflict, HTTPStatus(&pq.Error{Code: PG_UNIQUE_VIOLATION}))
+	assert.Equal(t, http.StatusUnprocessableEntity, HTTPStatus(&pq.Error{Code: PG_FOREIGN_KEY_VIOLATION}))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(errors.New("boom")))
+
+	assert.Equal(t, "NOT_FOUND", GraphQLCode(sql.ErrNoRows))
+	assert.Equal(t, "CONFLICT", GraphQLCode(&pq.Error{Code: PG_UNIQUE_VIOLATION}))
+	assert.Equal(t, "BAD_USER_INPUT", GraphQLCode(&pq.Error{Code: PG_CHECK_VIOLATION}))
+	assert.Equal(t, "RETRYABLE", GraphQLCode(&pq.Error{Code: PG_SERIALIZATION_FAILURE}))
+	assert.Equal(t, "INTERNAL_SERVER_ERROR", GraphQLCode(errors.New("boom")))
+
+	assert.True(t, IsRetryable(&pq.Error{Code: PG_DEADLOCK_DETECTED}))
+	assert.False(t, IsRetryable(&pq.Error{Code: PG_UNIQUE_VIOLATION}))
+}
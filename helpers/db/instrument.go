@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_SLOW_QUERY_THRESHOLD = 500 * time.Millisecond
+	TRACER_NAME                  = "github.com/litestack-hq/lgst-common/helpers/db"
+)
+
+type InstrumentOpts struct {
+	// Logger defaults to slog.Default()
+	Logger *slog.Logger
+	// Queries running longer than this are logged as warnings. Zero uses
+	// DEFAULT_SLOW_QUERY_THRESHOLD, a negative value disables the check.
+	SlowQueryThreshold time.Duration
+	// TracerProvider defaults to the global OpenTelemetry provider
+	TracerProvider trace.TracerProvider
+}
+
+// executor - Query methods shared by *sqlx.DB and *sqlx.Tx
+type executor interface {
+	DriverName() string
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
+	BindNamed(query string, arg any) (string, []any, error)
+}
+
+// InstrumentedDB - *sqlx.DB that logs, times and traces every statement.
+// Only the query methods below and the pool methods of rawDB are exposed,
+// so no statement can bypass the instrumentation by accident. Prepared
+// statements are not instrumented, prepare them on the DB field.
+type InstrumentedDB struct {
+	*instrumentedExecutor
+	rawDB
+}
+
+// InstrumentedTx - *sqlx.Tx counterpart of InstrumentedDB
+type InstrumentedTx struct {
+	*instrumentedExecutor
+	rawTx
+}
+
+// rawDB - The methods of *sqlx.DB that run no statement
+type rawDB struct{ DB *sqlx.DB }
+
+func (r rawDB) Ping() error                           { return r.DB.Ping() }
+func (r rawDB) PingContext(ctx context.Context) error { return r.DB.PingContext(ctx) }
+func (r rawDB) Close() error                          { return r.DB.Close() }
+func (r rawDB) Stats() sql.DBStats                    { return r.DB.Stats() }
+func (r rawDB) SetMaxOpenConns(n int)                 { r.DB.SetMaxOpenConns(n) }
+func (r rawDB) SetMaxIdleConns(n int)                 { r.DB.SetMaxIdleConns(n) }
+func (r rawDB) SetConnMaxLifetime(d time.Duration)    { r.DB.SetConnMaxLifetime(d) }
+func (r rawDB) SetConnMaxIdleTime(d time.Duration)    { r.DB.SetConnMaxIdleTime(d) }
+func (r rawDB) DriverName() string                    { return r.DB.DriverName() }
+func (r rawDB) Rebind(query string) string            { return r.DB.Rebind(query) }
+func (r rawDB) BindNamed(query string, arg any) (string, []any, error) {
+	return r.DB.BindNamed(query, arg)
+}
+
+// rawTx - The methods of *sqlx.Tx that run no statement
+type rawTx struct{ Tx *sqlx.Tx }
+
+func (r rawTx) Commit() error              { return r.Tx.Commit() }
+func (r rawTx) Rollback() error            { return r.Tx.Rollback() }
+func (r rawTx) DriverName() string         { return r.Tx.DriverName() }
+func (r rawTx) Rebind(query string) string { return r.Tx.Rebind(query) }
+func (r rawTx) BindNamed(query string, arg any) (string, []any, error) {
+	return r.Tx.BindNamed(query, arg)
+}
+
+type instrumentedExecutor struct {
+	ex     executor
+	opts   InstrumentOpts
+	tracer trace.Tracer
+	system string
+}
+
+func Instrument(db *sqlx.DB, opts InstrumentOpts) *InstrumentedDB {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if opts.SlowQueryThreshold == 0 {
+		opts.SlowQueryThreshold = DEFAULT_SLOW_QUERY_THRESHOLD
+	}
+
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+
+	return &InstrumentedDB{
+		instrumentedExecutor: newInstrumentedExecutor(db, opts),
+		rawDB:                rawDB{DB: db},
+	}
+}
+
+func newInstrumentedExecutor(ex executor, opts InstrumentOpts) *instrumentedExecutor {
+	system := ex.DriverName()
+	if system == "postgres" || system == "pgx" {
+		system = "postgresql"
+	}
+
+	return &instrumentedExecutor{
+		ex:     ex,
+		opts:   opts,
+		tracer: opts.TracerProvider.Tracer(TRACER_NAME),
+		system: system,
+	}
+}
+
+func (db *InstrumentedDB) Beginx() (*InstrumentedTx, error) {
+	return db.BeginTxx(context.Background(), nil)
+}
+
+func (db *InstrumentedDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*InstrumentedTx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InstrumentedTx{
+		instrumentedExecutor: newInstrumentedExecutor(tx, db.opts),
+		rawTx:                rawTx{Tx: tx},
+	}, nil
+}
+
+func (e *instrumentedExecutor) observe(ctx context.Context, query string, args []any, fn func(ctx context.Context) error) error {
+	operation := queryOperation(query)
+
+	ctx, span := e.tracer.Start(
+		ctx,
+		operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", e.system),
+			attribute.String("db.statement", query),
+			attribute.String("db.operation", operation),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	attrs := []any{
+		"query", query,
+		"args", redactArgs(args),
+		"duration", duration,
+	}
+
+	switch {
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		e.opts.Logger.ErrorContext(ctx, "query failed", append(attrs, "error", err)...)
+	case e.opts.SlowQueryThreshold > 0 && duration >= e.opts.SlowQueryThreshold:
+		span.SetAttributes(attribute.Bool("db.slow_query", true))
+		e.opts.Logger.WarnContext(ctx, "slow query", append(attrs, "threshold", e.opts.SlowQueryThreshold)...)
+	default:
+		e.opts.Logger.DebugContext(ctx, "query executed", attrs...)
+	}
+
+	return err
+}
+
+func (e *instrumentedExecutor) ExecContext(ctx context.Context, query string, args ...any) (result sql.Result, err error) {
+	err = e.observe(ctx, query, args, func(ctx context.Context) error {
+		result, err = e.ex.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+func (e *instrumentedExecutor) QueryContext(ctx context.Context, query string, args ...any) (rows *sql.Rows, err error) {
+	err = e.observe(ctx, query, args, func(ctx context.Context) error {
+		rows, err = e.ex.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (e *instrumentedExecutor) QueryxContext(ctx context.Context, query string, args ...any) (rows *sqlx.Rows, err error) {
+	err = e.observe(ctx, query, args, func(ctx context.Context) error {
+		rows, err = e.ex.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (e *instrumentedExecutor) QueryRowContext(ctx context.Context, query string, args ...any) (row *sql.Row) {
+	e.observe(ctx, query, args, func(ctx context.Context) error {
+		row = e.ex.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+func (e *instrumentedExecutor) QueryRowxContext(ctx context.Context, query string, args ...any) (row *sqlx.Row) {
+	e.observe(ctx, query, args, func(ctx context.Context) error {
+		row = e.ex.QueryRowxContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+func (e *instrumentedExecutor) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return e.observe(ctx, query, args, func(ctx context.Context) error {
+		return e.ex.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (e *instrumentedExecutor) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return e.observe(ctx, query, args, func(ctx context.Context) error {
+		return e.ex.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (e *instrumentedExecutor) NamedExecContext(ctx context.Context, query string, arg any) (result sql.Result, err error) {
+	err = e.observe(ctx, query, []any{arg}, func(ctx context.Context) error {
+		result, err = e.ex.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return result, err
+}
+
+// NamedQueryContext - Binds arg like sqlx does, then runs the bound query
+// through QueryxContext
+func (e *instrumentedExecutor) NamedQueryContext(ctx context.Context, query string, arg any) (*sqlx.Rows, error) {
+	bound, args, err := e.ex.BindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return e.QueryxContext(ctx, bound, args...)
+}
+
+func (e *instrumentedExecutor) MustExecContext(ctx context.Context, query string, args ...any) sql.Result {
+	result, err := e.ExecContext(ctx, query, args...)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (e *instrumentedExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return e.ExecContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) Query(query string, args ...any) (*sql.Rows, error) {
+	return e.QueryContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) Queryx(query string, args ...any) (*sqlx.Rows, error) {
+	return e.QueryxContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) QueryRow(query string, args ...any) *sql.Row {
+	return e.QueryRowContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) QueryRowx(query string, args ...any) *sqlx.Row {
+	return e.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (e *instrumentedExecutor) Get(dest any, query string, args ...any) error {
+	return e.GetContext(context.Background(), dest, query, args...)
+}
+
+func (e *instrumentedExecutor) Select(dest any, query string, args ...any) error {
+	return e.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (e *instrumentedExecutor) NamedExec(query string, arg any) (sql.Result, error) {
+	return e.NamedExecContext(context.Background(), query, arg)
+}
+
+func (e *instrumentedExecutor) NamedQuery(query string, arg any) (*sqlx.Rows, error) {
+	return e.NamedQueryContext(context.Background(), query, arg)
+}
+
+func (e *instrumentedExecutor) MustExec(query string, args ...any) sql.Result {
+	return e.MustExecContext(context.Background(), query, args...)
+}
+
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// redactArgs - Keeps the type of each argument but never its value
+func redactArgs(args []any) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = fmt.Sprintf("$%d=<%T>", i+1, arg)
+	}
+	return redacted
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeDriver - Just enough of a database/sql driver to exercise the wrappers.
+// Every query returns a single row with an "id" column, statements containing
+// "fail" return an error.
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct{ query string }
+
+type fakeRows struct{ done bool }
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeConn{}, nil }
+func (fakeConn) Commit() error                             { return nil }
+func (fakeConn) Rollback() error                           { return nil }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("statement failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("statement failed")
+	}
+	return &fakeRows{}, nil
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+func newInstrumentedTestDb(t *testing.T, threshold time.Duration) (*InstrumentedDB, *tracetest.InMemoryExporter, *bytes.Buffer) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	logs := &bytes.Buffer{}
+
+	db := Instrument(sqlx.MustOpen("fakedb", ""), InstrumentOpts{
+		Logger:             slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		SlowQueryThreshold: threshold,
+		TracerProvider:     provider,
+	})
+	t.Cleanup(func() { db.Close() })
+
+	return db, exporter, logs
+}
+
+func TestInstrumentedDB(t *testing.T) {
+	t.Run("Traces and logs statements", func(t *testing.T) {
+		db, exporter, logs := newInstrumentedTestDb(t, time.Hour)
+
+		var id int
+		err := db.GetContext(context.Background(), &id, "SELECT id FROM users WHERE email = $1", "john@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, id)
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, "SELECT", spans[0].Name)
+		assert.Contains(t, spans[0].Attributes, attribute.String("db.statement", "SELECT id FROM users WHERE email = $1"))
+		assert.Contains(t, spans[0].Attributes, attribute.String("db.operation", "SELECT"))
+
+		assert.Contains(t, logs.String(), "query executed")
+		assert.Contains(t, logs.String(), "$1=<string>")
+		assert.NotContains(t, logs.String(), "john@example.com")
+	})
+
+	t.Run("Records failures", func(t *testing.T) {
+		db, exporter, logs := newInstrumentedTestDb(t, time.Hour)
+
+		_, err := db.Exec("UPDATE fail SET name = $1", "John")
+		assert.NotNil(t, err)
+
+		spans := exporter.GetSpans()
+		assert.Equal(t, 1, len(spans))
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Contains(t, logs.String(), "query failed")
+	})
+
+	t.Run("Flags slow queries", func(t *testing.T) {
+		db, _, logs := newInstrumentedTestDb(t, time.Nanosecond)
+
+		_, err := db.Exec("DELETE FROM users")
+		assert.Nil(t, err)
+		assert.Contains(t, logs.String(), "slow query")
+	})
+
+	t.Run("Transactions are instrumented", func(t *testing.T) {
+		db, exporter, _ := newInstrumentedTestDb(t, time.Hour)
+
+		tx, err := db.Beginx()
+		assert.Nil(t, err)
+
+		var ids []int
+		assert.Nil(t, tx.Select(&ids, "SELECT id FROM users"))
+		assert.Nil(t, tx.Commit())
+		assert.Equal(t, []int{1}, ids)
+		assert.Equal(t, 1, len(exporter.GetSpans()))
+	})
+	t.Run("Named queries and MustExec are instrumented", func(t *testing.T) {
+		db, exporter, _ := newInstrumentedTestDb(t, time.Hour)
+
+		rows, err := db.NamedQuery("SELECT id FROM users WHERE email = :email", map[string]any{"email": "john@example.com"})
+		assert.Nil(t, err)
+		rows.Close()
+
+		db.MustExec("DELETE FROM users")
+		assert.Panics(t, func() { db.MustExec("DELETE FROM fail") })
+
+		assert.Equal(t, []string{"SELECT id FROM users WHERE email = ?", "DELETE FROM users", "DELETE FROM fail"}, spanStatements(exporter))
+	})
+
+	t.Run("Uninstrumented methods are not promoted", func(t *testing.T) {
+		for _, method := range []string{"Prepare", "Preparex", "PrepareNamed", "NamedStmt", "Stmtx"} {
+			_, onDB := reflect.TypeOf(&InstrumentedDB{}).MethodByName(method)
+			_, onTx := reflect.TypeOf(&InstrumentedTx{}).MethodByName(method)
+			assert.False(t, onDB || onTx, method)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/config"
+	"github.com/litestack-hq/lgst-common/helpers/utils"
+)
+
+const (
+	DRIVER_NAME = "postgres"
+
+	// DEFAULT_READY_TIMEOUT bounds the wait for the databases to accept
+	// connections when the context given to Open has no deadline
+	DEFAULT_READY_TIMEOUT = 30 * time.Second
+)
+
+var (
+	readOnlyQueryRx = regexp.MustCompile(`(?is)^\s*(SELECT|WITH|SHOW)\b`)
+	writingClauseRx = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE)\b|\bFOR\s+(NO\s+KEY\s+)?(UPDATE|SHARE|KEY\s+SHARE)\b`)
+	// Functions that write or take locks, which a hot standby refuses
+	writingFunctionRx = regexp.MustCompile(`(?i)\b(nextval|setval|pg_advisory_\w+|pg_try_advisory_\w+|pg_notify|txid_current|pg_current_xact_id|lo_\w+)\s*\(`)
+	errNoDatabaseURL  = errors.New("DB_URL is not set")
+)
+
+type HealthCheck func(ctx context.Context) error
+
+// HealthRegistry - Anything health checks can be registered with, e.g. the
+// readiness endpoint of a service
+type HealthRegistry interface {
+	Register(name string, check HealthCheck)
+}
+
+type OpenOpts struct {
+	// Migrations are applied on the primary once it is reachable, when set
+	// and cfg.DB_RUN_MIGRATIONS is true
+	Migrations source.Driver
+	// HealthRegistry receives one check per connection pool, when set
+	HealthRegistry HealthRegistry
+	// ReadyTimeout bounds the wait for the databases when ctx has no
+	// deadline, defaults to DEFAULT_READY_TIMEOUT
+	ReadyTimeout time.Duration
+}
+
+// DB - Application connection pool. The embedded *sqlx.DB is the primary,
+// read-only queries are routed to the replicas in round robin when there are any.
+type DB struct {
+	*sqlx.DB
+	replicas []*sqlx.DB
+	next     atomic.Uint32
+}
+
+type primaryCtxKey struct{}
+
+// Open - Builds the application pool from cfg, waits for every database to
+// accept connections and runs the migrations if requested
+func Open(ctx context.Context, cfg *config.Config, opts ...OpenOpts) (*DB, error) {
+	var opt OpenOpts
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if cfg.DB_URL == "" {
+		return nil, errNoDatabaseURL
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		if opt.ReadyTimeout <= 0 {
+			opt.ReadyTimeout = DEFAULT_READY_TIMEOUT
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.ReadyTimeout)
+		defer cancel()
+	}
+
+	primary, err := openPool(ctx, cfg, cfg.DB_URL)
+	if err != nil {
+		return nil, fmt.Errorf("primary database: %w", err)
+	}
+
+	db := &DB{DB: primary}
+
+	for i, url := range cfg.DB_REPLICA_URLS {
+		replica, err := openPool(ctx, cfg, url)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica database %d: %w", i, err)
+		}
+		db.replicas = append(db.replicas, replica)
+	}
+
+	if cfg.DB_RUN_MIGRATIONS && opt.Migrations != nil {
+		if err := utils.RunMigrations(cfg.DB_URL, opt.Migrations); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrations: %w", err)
+		}
+	}
+
+	if opt.HealthRegistry != nil {
+		for name, check := range db.HealthChecks() {
+			opt.HealthRegistry.Register(name, check)
+		}
+	}
+
+	return db, nil
+}
+
+func openPool(ctx context.Context, cfg *config.Config, url string) (*sqlx.DB, error) {
+	pool, err := sqlx.Open(DRIVER_NAME, withStatementTimeout(url, cfg.DB.STATEMENT_TIMEOUT))
+	if err != nil {
+		return nil, err
+	}
+
+	pool.SetMaxOpenConns(cfg.DB.MAX_OPEN_CONNS)
+	pool.SetMaxIdleConns(cfg.DB.MAX_IDLE_CONNS)
+	pool.SetConnMaxLifetime(cfg.DB.CONN_MAX_LIFETIME)
+	pool.SetConnMaxIdleTime(cfg.DB.CONN_MAX_IDLE_TIME)
+
+	if err := utils.WaitFor(ctx, utils.DBProbe("postgres", pool.DB), utils.DEFAULT_BACKOFF_POLICY); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// withStatementTimeout - Sets statement_timeout on every session of the pool,
+// unless dsn already does. lib/pq passes unknown parameters on to the server.
+func withStatementTimeout(dsn string, timeout time.Duration) string {
+	if timeout <= 0 || strings.Contains(dsn, "statement_timeout") {
+		return dsn
+	}
+
+	value := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		// key=value connection strings
+		return dsn + " statement_timeout=" + value
+	}
+
+	query := u.Query()
+	query.Set("statement_timeout", value)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// WithPrimary - Forces reads made with the returned context onto the primary,
+// for callers that must read their own writes
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// IsReadOnlyQuery - Reports whether query can safely run on a replica. Calls
+// of sequence, advisory lock and large object functions count as writes. User
+// functions that write cannot be told apart, run them under WithPrimary.
+func IsReadOnlyQuery(query string) bool {
+	return readOnlyQueryRx.MatchString(query) && !writingClauseRx.MatchString(query) && !writingFunctionRx.MatchString(query)
+}
+
+// Replicas - Read replica pools, empty when none are configured
+func (db *DB) Replicas() []*sqlx.DB {
+	return db.replicas
+}
+
+// Reader - Pool the next read-only query should go to
+func (db *DB) Reader() *sqlx.DB {
+	if len(db.replicas) == 0 {
+		return db.DB
+	}
+
+	n := db.next.Add(1)
+	return db.replicas[int(n-1)%len(db.replicas)]
+}
+
+func (db *DB) route(ctx context.Context, query string) *sqlx.DB {
+	if forced, _ := ctx.Value(primaryCtxKey{}).(bool); forced || !IsReadOnlyQuery(query) {
+		return db.DB
+	}
+	return db.Reader()
+}
+
+// HealthChecks - One ping check per pool, keyed by a stable name
+func (db *DB) HealthChecks() map[string]HealthCheck {
+	checks := map[string]HealthCheck{
+		"db-primary": db.DB.PingContext,
+	}
+
+	for i, replica := range db.replicas {
+		checks[fmt.Sprintf("db-replica-%d", i)] = replica.PingContext
+	}
+
+	return checks
+}
+
+// PingContext - Checks every pool, returning all the failures
+func (db *DB) PingContext(ctx context.Context) error {
+	errs := []error{}
+
+	for name, check := range db.HealthChecks() {
+		if err := check(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (db *DB) Ping() error {
+	return db.PingContext(context.Background())
+}
+
+func (db *DB) Close() error {
+	errs := []error{db.DB.Close()}
+
+	for _, replica := range db.replicas {
+		errs = append(errs, replica.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.route(ctx, query).QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	return db.route(ctx, query).QueryxContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.route(ctx, query).QueryRowContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	return db.route(ctx, query).QueryRowxContext(ctx, query, args...)
+}
+
+func (db *DB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.route(ctx, query).GetContext(ctx, dest, query, args...)
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	return db.route(ctx, query).SelectContext(ctx, dest, query, args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *DB) Queryx(query string, args ...any) (*sqlx.Rows, error) {
+	return db.QueryxContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRowx(query string, args ...any) *sqlx.Row {
+	return db.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (db *DB) Get(dest any, query string, args ...any) error {
+	return db.GetContext(context.Background(), dest, query, args...)
+}
+
+func (db *DB) Select(dest any, query string, args ...any) error {
+	return db.SelectContext(context.Background(), dest, query, args...)
+}
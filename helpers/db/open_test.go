@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type healthRegistry map[string]HealthCheck
+
+func (r healthRegistry) Register(name string, check HealthCheck) {
+	r[name] = check
+}
+
+func TestIsReadOnlyQuery(t *testing.T) {
+	assert.True(t, IsReadOnlyQuery("SELECT * FROM users"))
+	assert.True(t, IsReadOnlyQuery("  select id from users where deleted_at is null"))
+	assert.True(t, IsReadOnlyQuery("WITH active AS (SELECT * FROM users) SELECT * FROM active"))
+	assert.True(t, IsReadOnlyQuery("SHOW search_path"))
+
+	assert.False(t, IsReadOnlyQuery("INSERT INTO users (name) VALUES ($1) RETURNING *"))
+	assert.False(t, IsReadOnlyQuery("UPDATE users SET name = $1 WHERE id = $2"))
+	assert.False(t, IsReadOnlyQuery("SELECT * FROM users WHERE id = $1 FOR UPDATE"))
+	assert.False(t, IsReadOnlyQuery("SELECT * FROM jobs LIMIT 1 FOR NO KEY UPDATE SKIP LOCKED"))
+	assert.False(t, IsReadOnlyQuery("WITH moved AS (DELETE FROM queue RETURNING *) SELECT * FROM moved"))
+	assert.False(t, IsReadOnlyQuery("SELECT nextval('orders_id_seq')"))
+	assert.False(t, IsReadOnlyQuery("SELECT setval('orders_id_seq', 42)"))
+	assert.False(t, IsReadOnlyQuery("SELECT pg_advisory_lock($1)"))
+	assert.False(t, IsReadOnlyQuery("SELECT pg_try_advisory_xact_lock(hashtext($1))"))
+	assert.False(t, IsReadOnlyQuery("SELECT pg_notify('jobs', $1)"))
+	assert.False(t, IsReadOnlyQuery("SELECT lo_create(0)"))
+	assert.True(t, IsReadOnlyQuery("SELECT next_value, settings FROM counters"))
+}
+
+func TestDBRouting(t *testing.T) {
+	primary := sqlx.MustOpen("fakedb", "primary")
+	replica1 := sqlx.MustOpen("fakedb", "replica1")
+	replica2 := sqlx.MustOpen("fakedb", "replica2")
+	db := &DB{DB: primary, replicas: []*sqlx.DB{replica1, replica2}}
+	defer db.Close()
+
+	ctx := context.Background()
+	readQuery := "SELECT * FROM users"
+
+	assert.Same(t, replica1, db.route(ctx, readQuery))
+	assert.Same(t, replica2, db.route(ctx, readQuery))
+	assert.Same(t, replica1, db.route(ctx, readQuery))
+	assert.Same(t, primary, db.route(ctx, "DELETE FROM users"))
+	assert.Same(t, primary, db.route(WithPrimary(ctx), readQuery))
+
+	var ids []int
+	assert.Nil(t, db.Select(&ids, readQuery))
+	assert.Equal(t, []int{1}, ids)
+
+	registry := healthRegistry{}
+	for name, check := range db.HealthChecks() {
+		registry.Register(name, check)
+	}
+	assert.Equal(t, 3, len(registry))
+	assert.Nil(t, registry["db-replica-1"](ctx))
+	assert.Nil(t, db.Ping())
+
+	t.Run("Without replicas reads go to the primary", func(t *testing.T) {
+		db := &DB{DB: primary}
+		assert.Same(t, primary, db.route(ctx, readQuery))
+	})
+}
+
+func TestOpenRequiresDbUrl(t *testing.T) {
+	_, err := Open(context.Background(), &config.Config{})
+	assert.ErrorIs(t, err, errNoDatabaseURL)
+}
+
+func TestOpenBoundsReadiness(t *testing.T) {
+	// Nothing listens on port 1, so the wait only ends with ReadyTimeout
+	cfg := &config.Config{DB_URL: "postgres://app@127.0.0.1:1/app?sslmode=disable"}
+
+	start := time.Now()
+	_, err := Open(context.Background(), cfg, OpenOpts{ReadyTimeout: 300 * time.Millisecond})
+	assert.ErrorContains(t, err, "primary database")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	assert.Equal(t, "postgres://db/app?sslmode=disable&statement_timeout=5000", withStatementTimeout("postgres://db/app?sslmode=disable", 5*time.Second))
+	assert.Equal(t, "host=db dbname=app statement_timeout=250", withStatementTimeout("host=db dbname=app", 250*time.Millisecond))
+	assert.Equal(t, "postgres://db/app?statement_timeout=1", withStatementTimeout("postgres://db/app?statement_timeout=1", time.Second))
+	assert.Equal(t, "postgres://db/app", withStatementTimeout("postgres://db/app", 0))
+}
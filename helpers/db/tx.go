@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Executor - What repositories should accept to run queries. *sqlx.DB,
+// *sqlx.Tx, *DB, *InstrumentedDB and *InstrumentedTx all satisfy it.
+type Executor interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// transaction - An Executor that is already inside a transaction
+type transaction interface {
+	Executor
+	Commit() error
+	Rollback() error
+}
+
+type sqlxBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+var savepointCounter atomic.Uint64
+
+// RunInTx - Runs fn in a transaction, committing when it returns nil and
+// rolling back otherwise. When ex is already a transaction, e.g. the one a
+// test is wrapped in, fn runs in a savepoint instead, so nesting never
+// commits the outer transaction.
+func RunInTx(ctx context.Context, ex Executor, fn func(tx Executor) error) error {
+	switch ex := ex.(type) {
+	case transaction:
+		return runInSavepoint(ctx, ex, fn)
+	case *InstrumentedDB:
+		tx, err := ex.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return runTx(tx, fn)
+	case sqlxBeginner:
+		tx, err := ex.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return runTx(tx, fn)
+	default:
+		return fmt.Errorf("cannot start a transaction on %T", ex)
+	}
+}
+
+// runTx - Commits when fn returns nil and rolls back otherwise, also when
+// fn panics, so the connection goes back to the pool. The panic goes on.
+func runTx(tx transaction, fn func(tx Executor) error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+func runInSavepoint(ctx context.Context, tx transaction, fn func(tx Executor) error) error {
+	name := fmt.Sprintf("lgst_savepoint_%d", savepointCounter.Add(1))
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		return errors.Join(err, rollbackErr)
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
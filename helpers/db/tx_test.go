@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanStatements(exporter *tracetest.InMemoryExporter) []string {
+	statements := []string{}
+	for _, span := range exporter.GetSpans() {
+		for _, attr := range span.Attributes {
+			if attr.Key == "db.statement" {
+				statements = append(statements, attr.Value.AsString())
+			}
+		}
+	}
+	return statements
+}
+
+func TestRunInTx(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Executors satisfy the interface", func(t *testing.T) {
+		var _ Executor = &sqlx.DB{}
+		var _ Executor = &sqlx.Tx{}
+		var _ Executor = &DB{}
+		var _ Executor = &InstrumentedDB{}
+		var _ Executor = &InstrumentedTx{}
+	})
+
+	t.Run("Starts a transaction on a pool", func(t *testing.T) {
+		db, exporter, _ := newInstrumentedTestDb(t, time.Hour)
+
+		err := RunInTx(ctx, db, func(tx Executor) error {
+			_, isTx := tx.(*InstrumentedTx)
+			assert.True(t, isTx)
+			_, err := tx.ExecContext(ctx, "DELETE FROM users")
+			return err
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"DELETE FROM users"}, spanStatements(exporter))
+	})
+
+	t.Run("Nests with savepoints", func(t *testing.T) {
+		db, exporter, _ := newInstrumentedTestDb(t, time.Hour)
+
+		outer, err := db.Beginx()
+		assert.Nil(t, err)
+		defer outer.Rollback()
+
+		failure := errors.New("failed")
+		err = RunInTx(ctx, outer, func(tx Executor) error {
+			if err := RunInTx(ctx, tx, func(tx Executor) error { return nil }); err != nil {
+				return err
+			}
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+
+		statements := spanStatements(exporter)
+		assert.Equal(t, 4, len(statements))
+		assert.Regexp(t, `^SAVEPOINT lgst_savepoint_\d+$`, statements[0])
+		assert.Regexp(t, `^SAVEPOINT lgst_savepoint_\d+$`, statements[1])
+		assert.Regexp(t, `^RELEASE SAVEPOINT `, statements[2])
+		assert.Equal(t, "ROLLBACK TO SAVEPOINT"+statements[0][len("SAVEPOINT"):], statements[3])
+	})
+
+	t.Run("Rolls back when fn panics", func(t *testing.T) {
+		db, exporter, _ := newInstrumentedTestDb(t, time.Hour)
+
+		var inner Executor
+		assert.PanicsWithValue(t, "boom", func() {
+			RunInTx(ctx, db, func(tx Executor) error {
+				inner = tx
+				panic("boom")
+			})
+		})
+		assert.ErrorIs(t, inner.(*InstrumentedTx).Commit(), sql.ErrTxDone)
+
+		outer, err := db.Beginx()
+		assert.Nil(t, err)
+		defer outer.Rollback()
+
+		assert.Panics(t, func() {
+			RunInTx(ctx, outer, func(tx Executor) error { panic("boom") })
+		})
+
+		statements := spanStatements(exporter)
+		assert.Equal(t, 2, len(statements))
+		assert.Equal(t, "ROLLBACK TO "+statements[0], statements[1])
+	})
+
+	t.Run("Plain sqlx pools", func(t *testing.T) {
+		db := sqlx.MustOpen("fakedb", "")
+		defer db.Close()
+
+		assert.Nil(t, RunInTx(ctx, db, func(tx Executor) error {
+			_, isTx := tx.(*sqlx.Tx)
+			assert.True(t, isTx)
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+const (
+	TIMESTAMP_VERSION_FORMAT = "20060102150405"
+	DEFAULT_VERSION_DIGITS   = 3
+)
+
+var nonIdentifierRx = regexp.MustCompile(`[^a-z0-9]+`)
+
+type CreateOpts struct {
+	Dir  string
+	Name string
+	// Sequential numbers the files 001, 002... after the highest existing
+	// version instead of using a UTC timestamp
+	Sequential bool
+	// Digits pads sequential versions, defaults to DEFAULT_VERSION_DIGITS
+	Digits int
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// Create - Writes an empty NNN_name.up.sql and NNN_name.down.sql pair to
+// opts.Dir and returns their paths
+func Create(opts CreateOpts) (string, string, error) {
+	name := strings.Trim(nonIdentifierRx.ReplaceAllString(strings.ToLower(opts.Name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is empty")
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	version, err := nextVersion(opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	up := filepath.Join(opts.Dir, fmt.Sprintf("%s_%s.up.sql", version, name))
+	down := filepath.Join(opts.Dir, fmt.Sprintf("%s_%s.down.sql", version, name))
+
+	for _, file := range []string{up, down} {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		f.Close()
+	}
+
+	return up, down, nil
+}
+
+func nextVersion(opts CreateOpts) (string, error) {
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	existing := map[uint]bool{}
+	var highest uint
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		// A misnamed file would be skipped by golang-migrate as well, and
+		// could end up with the version the next one gets
+		migration, err := source.DefaultParse(entry.Name())
+		if err != nil {
+			return "", fmt.Errorf("%s is not named like VERSION_name.up.sql: %w", entry.Name(), err)
+		}
+
+		existing[migration.Version] = true
+		if migration.Version > highest {
+			highest = migration.Version
+		}
+	}
+
+	if opts.Sequential {
+		digits := opts.Digits
+		if digits <= 0 {
+			digits = DEFAULT_VERSION_DIGITS
+		}
+		return fmt.Sprintf("%0*d", digits, highest+1), nil
+	}
+
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	version := now().UTC().Format(TIMESTAMP_VERSION_FORMAT)
+
+	parsed, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid version %s: %w", version, err)
+	}
+
+	if existing[uint(parsed)] || uint(parsed) <= highest {
+		return "", fmt.Errorf("version %s is not newer than the existing version %d", version, highest)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreate(t *testing.T) {
+	t.Run("Timestamped", func(t *testing.T) {
+		dir := t.TempDir()
+		now := func() time.Time { return time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC) }
+
+		up, down, err := Create(CreateOpts{Dir: dir, Name: "Add users' phone number", Now: now})
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(dir, "20240305093000_add_users_phone_number.up.sql"), up)
+		assert.Equal(t, filepath.Join(dir, "20240305093000_add_users_phone_number.down.sql"), down)
+		assert.FileExists(t, up)
+		assert.FileExists(t, down)
+
+		_, _, err = Create(CreateOpts{Dir: dir, Name: "again", Now: now})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Sequential", func(t *testing.T) {
+		dir := t.TempDir()
+
+		up, _, err := Create(CreateOpts{Dir: dir, Name: "create_users", Sequential: true})
+		assert.Nil(t, err)
+		assert.Equal(t, "001_create_users.up.sql", filepath.Base(up))
+
+		up, _, err = Create(CreateOpts{Dir: dir, Name: "create_wallets", Sequential: true})
+		assert.Nil(t, err)
+		assert.Equal(t, "002_create_wallets.up.sql", filepath.Base(up))
+
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "010_manual.up.sql"), nil, 0o644))
+		up, _, err = Create(CreateOpts{Dir: dir, Name: "next", Sequential: true, Digits: 4})
+		assert.Nil(t, err)
+		assert.Equal(t, "0011_next.up.sql", filepath.Base(up))
+	})
+
+	t.Run("Rejects misnamed migration files", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "create_users.up.sql"), nil, 0o644))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o644))
+
+		_, _, err := Create(CreateOpts{Dir: dir, Name: "next", Sequential: true})
+		assert.ErrorContains(t, err, "create_users.up.sql")
+	})
+
+	t.Run("Rejects empty names", func(t *testing.T) {
+		_, _, err := Create(CreateOpts{Dir: t.TempDir(), Name: " -- "})
+		assert.NotNil(t, err)
+	})
+}
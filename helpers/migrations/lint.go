@@ -0,0 +1,403 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+type Severity string
+
+const (
+	SEVERITY_ERROR   Severity = "error"
+	SEVERITY_WARNING Severity = "warning"
+)
+
+type Rule string
+
+const (
+	RULE_NON_CONCURRENT_INDEX     Rule = "non-concurrent-index"
+	RULE_NOT_NULL_WITHOUT_DEFAULT Rule = "not-null-without-default"
+	RULE_COLUMN_TYPE_CHANGE       Rule = "column-type-change"
+	RULE_MISSING_DOWN             Rule = "missing-down"
+	RULE_VERSION_GAP              Rule = "version-gap"
+	RULE_DUPLICATE_VERSION        Rule = "duplicate-version"
+)
+
+// Versions at least this large are taken to be timestamps, which are never
+// contiguous, so gaps are only reported below it
+const SEQUENTIAL_VERSION_LIMIT = 1_000_000_000
+
+var (
+	createIndexRx           = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\b`)
+	createIndexConcurrentRx = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\b`)
+	indexTableRx            = regexp.MustCompile(`(?is)\bON\s+(?:ONLY\s+)?([\w."]+)`)
+	createTableRx           = regexp.MustCompile(`(?is)\bCREATE\s+(?:UNLOGGED\s+|TEMP(?:ORARY)?\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)`)
+	alterTableRx            = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?([\w."]+)`)
+	addColumnRx             = regexp.MustCompile(`(?is)\bADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?("?\w+"?)`)
+	columnTypeRx            = regexp.MustCompile(`(?is)\bALTER\s+(?:COLUMN\s+)?("?\w+"?)\s+(?:SET\s+DATA\s+)?TYPE\b`)
+	notNullRx               = regexp.MustCompile(`(?i)\bNOT\s+NULL\b`)
+	defaultRx               = regexp.MustCompile(`(?i)\bDEFAULT\b`)
+)
+
+// Words following ADD that introduce a constraint rather than a column
+var addConstraintKeywords = map[string]bool{
+	"CONSTRAINT": true,
+	"PRIMARY":    true,
+	"UNIQUE":     true,
+	"FOREIGN":    true,
+	"CHECK":      true,
+	"EXCLUDE":    true,
+}
+
+// Finding - One problem found by Lint. Line is 0 for findings about files
+// rather than statements.
+type Finding struct {
+	File     string
+	Line     int
+	Version  uint
+	Rule     Rule
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	location := f.File
+	if f.Line > 0 {
+		location += fmt.Sprintf(":%d", f.Line)
+	}
+	return fmt.Sprintf("%s: %s [%s] %s", location, f.Severity, f.Rule, f.Message)
+}
+
+type statement struct {
+	sql  string
+	line int
+}
+
+// Lint - Checks the migration files in dir of fsys for operations that lock
+// or break big tables, and for gaps and inconsistencies in the file set
+func Lint(fsys fs.FS, dir string) ([]Finding, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []Finding{}
+	files := map[uint]map[source.Direction][]string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		migration, err := source.DefaultParse(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if files[migration.Version] == nil {
+			files[migration.Version] = map[source.Direction][]string{}
+		}
+		files[migration.Version][migration.Direction] = append(files[migration.Version][migration.Direction], entry.Name())
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		findings = append(findings, lintSQL(entry.Name(), migration.Version, string(contents))...)
+	}
+
+	findings = append(findings, lintFileSet(files)...)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Version != findings[j].Version {
+			return findings[i].Version < findings[j].Version
+		}
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+
+	return findings, nil
+}
+
+// HasErrors - Reports whether any finding has SEVERITY_ERROR
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+func lintFileSet(files map[uint]map[source.Direction][]string) []Finding {
+	findings := []Finding{}
+	versions := make([]uint, 0, len(files))
+
+	for version, directions := range files {
+		versions = append(versions, version)
+
+		for _, names := range directions {
+			for _, name := range names[1:] {
+				findings = append(findings, Finding{
+					File:     name,
+					Version:  version,
+					Rule:     RULE_DUPLICATE_VERSION,
+					Severity: SEVERITY_ERROR,
+					Message:  fmt.Sprintf("version %d is also used by %s", version, names[0]),
+				})
+			}
+		}
+
+		if ups := directions[source.Up]; len(ups) > 0 && len(directions[source.Down]) == 0 {
+			findings = append(findings, Finding{
+				File:     ups[0],
+				Version:  version,
+				Rule:     RULE_MISSING_DOWN,
+				Severity: SEVERITY_WARNING,
+				Message:  "no down migration, this version cannot be reverted",
+			})
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for i := 1; i < len(versions); i++ {
+		previous, current := versions[i-1], versions[i]
+		if current >= SEQUENTIAL_VERSION_LIMIT || current == previous+1 {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			File:     firstFile(files[current]),
+			Version:  current,
+			Rule:     RULE_VERSION_GAP,
+			Severity: SEVERITY_WARNING,
+			Message:  fmt.Sprintf("versions %d to %d are missing", previous+1, current-1),
+		})
+	}
+
+	return findings
+}
+
+func lintSQL(file string, version uint, contents string) []Finding {
+	findings := []Finding{}
+	statements := splitStatements(contents)
+	createdTables := map[string]bool{}
+
+	for _, stmt := range statements {
+		if match := createTableRx.FindStringSubmatch(stmt.sql); match != nil {
+			createdTables[normalizeIdentifier(match[1])] = true
+		}
+	}
+
+	finding := func(stmt statement, rule Rule, severity Severity, message string) {
+		findings = append(findings, Finding{
+			File:     file,
+			Line:     stmt.line,
+			Version:  version,
+			Rule:     rule,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+
+	for _, stmt := range statements {
+		if createIndexRx.MatchString(stmt.sql) && !createIndexConcurrentRx.MatchString(stmt.sql) {
+			table := ""
+			if match := indexTableRx.FindStringSubmatch(stmt.sql); match != nil {
+				table = normalizeIdentifier(match[1])
+			}
+
+			if !createdTables[table] {
+				finding(stmt, RULE_NON_CONCURRENT_INDEX, SEVERITY_ERROR,
+					fmt.Sprintf("CREATE INDEX on %s blocks writes while it builds, use CREATE INDEX CONCURRENTLY", table))
+			}
+		}
+
+		match := alterTableRx.FindStringSubmatch(stmt.sql)
+		if match == nil {
+			continue
+		}
+
+		table := normalizeIdentifier(match[1])
+		if createdTables[table] {
+			continue
+		}
+
+		for _, match := range addColumnRx.FindAllStringSubmatchIndex(stmt.sql, -1) {
+			column := stmt.sql[match[2]:match[3]]
+			if addConstraintKeywords[strings.ToUpper(column)] {
+				continue
+			}
+
+			definition := columnDefinition(stmt.sql[match[1]:])
+			if notNullRx.MatchString(definition) && !defaultRx.MatchString(definition) {
+				finding(stmt, RULE_NOT_NULL_WITHOUT_DEFAULT, SEVERITY_ERROR,
+					fmt.Sprintf("adding NOT NULL column %s to %s without a DEFAULT fails on existing rows", column, table))
+			}
+		}
+
+		for _, column := range columnTypeRx.FindAllStringSubmatch(stmt.sql, -1) {
+			finding(stmt, RULE_COLUMN_TYPE_CHANGE, SEVERITY_WARNING,
+				fmt.Sprintf("changing the type of %s.%s may rewrite the table under an exclusive lock", table, column[1]))
+		}
+	}
+
+	return findings
+}
+
+// columnDefinition - s up to the comma ending the column definition it
+// starts with, commas inside parentheses such as NUMERIC(10,2) or quotes
+// do not count
+func columnDefinition(s string) string {
+	depth := 0
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth <= 0:
+			return s[:i]
+		}
+	}
+
+	return s
+}
+
+// splitStatements - Splits on semicolons, ignoring line and block comments
+// and semicolons inside quotes or dollar quoted bodies
+func splitStatements(contents string) []statement {
+	statements := []statement{}
+	current := strings.Builder{}
+	line, startLine := 1, 0
+	var quote string
+
+	flush := func() {
+		sql := strings.TrimSpace(current.String())
+		if sql != "" {
+			statements = append(statements, statement{sql: sql, line: startLine})
+		}
+		current.Reset()
+		startLine = 0
+	}
+
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+
+		switch {
+		case quote == "" && c == '-' && strings.HasPrefix(contents[i:], "--"):
+			end := strings.IndexByte(contents[i:], '\n')
+			if end < 0 {
+				end = len(contents) - i
+			}
+			i += end - 1
+			continue
+		case quote == "" && c == '/' && strings.HasPrefix(contents[i:], "/*"):
+			end := blockCommentEnd(contents[i:])
+			line += strings.Count(contents[i:i+end], "\n")
+			i += end - 1
+			// Keeps the tokens on both sides apart
+			current.WriteByte(' ')
+			continue
+		case quote == "" && (c == '\'' || c == '"'):
+			quote = string(c)
+		case quote == "" && c == '$':
+			if tag := dollarQuoteTag(contents[i:]); tag != "" {
+				quote = tag
+				current.WriteString(tag)
+				i += len(tag) - 1
+				continue
+			}
+		case quote != "" && strings.HasPrefix(contents[i:], quote):
+			current.WriteString(quote)
+			i += len(quote) - 1
+			quote = ""
+			continue
+		case quote == "" && c == ';':
+			flush()
+			continue
+		}
+
+		if c == '\n' {
+			line++
+		} else if startLine == 0 && c != ' ' && c != '\t' && c != '\r' {
+			startLine = line
+		}
+
+		current.WriteByte(c)
+	}
+
+	flush()
+
+	return statements
+}
+
+// blockCommentEnd - Length of the /* */ comment at the start of s, which
+// nests in PostgreSQL, or len(s) when it is never closed
+func blockCommentEnd(s string) int {
+	depth := 0
+
+	for i := 0; i < len(s)-1; i++ {
+		switch s[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return len(s)
+}
+
+// dollarQuoteTag - The $tag$ opening a dollar quoted string at the start of s
+func dollarQuoteTag(s string) string {
+	end := strings.IndexByte(s[1:], '$')
+	if end < 0 {
+		return ""
+	}
+
+	tag := s[:end+2]
+	for _, r := range tag[1 : len(tag)-1] {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9') {
+			return ""
+		}
+	}
+
+	return tag
+}
+
+func normalizeIdentifier(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, `"`, ""))
+}
+
+func firstFile(directions map[source.Direction][]string) string {
+	if names := directions[source.Up]; len(names) > 0 {
+		return names[0]
+	}
+	return directions[source.Down][0]
+}
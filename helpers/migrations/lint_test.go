@@ -0,0 +1,134 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func findingsByRule(findings []Finding) map[Rule][]Finding {
+	byRule := map[Rule][]Finding{}
+	for _, finding := range findings {
+		byRule[finding.Rule] = append(byRule[finding.Rule], finding)
+	}
+	return byRule
+}
+
+func TestLint(t *testing.T) {
+	t.Run("Clean migrations", func(t *testing.T) {
+		findings, err := Lint(testMigrations, "testdata/migrations")
+		assert.Nil(t, err)
+		assert.Empty(t, findings)
+		assert.False(t, HasErrors(findings))
+	})
+
+	t.Run("Dangerous operations", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/1_create_users.up.sql": {Data: []byte(`
+CREATE TABLE users (id UUID PRIMARY KEY, email TEXT NOT NULL);
+-- Indexes on a table created in the same migration are fine
+CREATE INDEX users_email_idx ON users (email);
+`)},
+			"migrations/1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+			"migrations/2_harden_users.up.sql": {Data: []byte(`CREATE INDEX CONCURRENTLY users_id_idx ON users (id);
+
+CREATE UNIQUE INDEX users_lower_email_idx
+    ON users (lower(email));
+
+ALTER TABLE users
+    ADD COLUMN name TEXT NOT NULL,
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT true,
+    ADD CONSTRAINT users_email_not_empty CHECK (email <> '');
+
+ALTER TABLE users ALTER COLUMN email TYPE VARCHAR(255);
+
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now(); -- no CREATE INDEX here;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+`)},
+		}
+
+		findings, err := Lint(fsys, "migrations")
+		assert.Nil(t, err)
+		assert.True(t, HasErrors(findings))
+
+		byRule := findingsByRule(findings)
+
+		assert.Equal(t, 1, len(byRule[RULE_NON_CONCURRENT_INDEX]))
+		assert.Equal(t, "2_harden_users.up.sql", byRule[RULE_NON_CONCURRENT_INDEX][0].File)
+		assert.Equal(t, 3, byRule[RULE_NON_CONCURRENT_INDEX][0].Line)
+
+		assert.Equal(t, 1, len(byRule[RULE_NOT_NULL_WITHOUT_DEFAULT]))
+		assert.Contains(t, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][0].Message, "column name")
+		assert.Equal(t, 6, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][0].Line)
+
+		assert.Equal(t, 1, len(byRule[RULE_COLUMN_TYPE_CHANGE]))
+		assert.Equal(t, 11, byRule[RULE_COLUMN_TYPE_CHANGE][0].Line)
+
+		assert.Equal(t, 1, len(byRule[RULE_MISSING_DOWN]))
+		assert.Equal(t, uint(2), byRule[RULE_MISSING_DOWN][0].Version)
+
+		assert.Equal(t, 4, len(findings))
+	})
+
+	t.Run("Commas in types and block comments", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/1_orders.up.sql": {Data: []byte(`/* The customer's orders,
+   see /* nested */ the spec */
+ALTER TABLE orders ADD COLUMN total NUMERIC(10,2) NOT NULL, ADD COLUMN note TEXT;
+
+ALTER TABLE orders ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'EUR';
+ALTER TABLE orders ADD COLUMN paid_at TIMESTAMPTZ NOT NULL;
+`)},
+			"migrations/1_orders.down.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		findings, err := Lint(fsys, "migrations")
+		assert.Nil(t, err)
+
+		byRule := findingsByRule(findings)
+		assert.Equal(t, 2, len(byRule[RULE_NOT_NULL_WITHOUT_DEFAULT]))
+		assert.Contains(t, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][0].Message, "column total")
+		assert.Equal(t, 3, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][0].Line)
+		assert.Contains(t, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][1].Message, "column paid_at")
+		assert.Equal(t, 6, byRule[RULE_NOT_NULL_WITHOUT_DEFAULT][1].Line)
+	})
+
+	t.Run("File set problems", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/1_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/1_a.down.sql": {Data: []byte("SELECT 1;")},
+			"migrations/1_b.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/4_c.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/4_c.down.sql": {Data: []byte("SELECT 1;")},
+			"migrations/README.md":    {Data: []byte("not a migration")},
+		}
+
+		findings, err := Lint(fsys, "migrations")
+		assert.Nil(t, err)
+
+		byRule := findingsByRule(findings)
+		assert.Equal(t, 1, len(byRule[RULE_DUPLICATE_VERSION]))
+		assert.Equal(t, "1_b.up.sql", byRule[RULE_DUPLICATE_VERSION][0].File)
+		assert.Equal(t, 1, len(byRule[RULE_VERSION_GAP]))
+		assert.Equal(t, "versions 2 to 3 are missing", byRule[RULE_VERSION_GAP][0].Message)
+		assert.Empty(t, byRule[RULE_MISSING_DOWN])
+	})
+
+	t.Run("Timestamp versions have no gaps", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/20240101120000_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/20240101120000_a.down.sql": {Data: []byte("SELECT 1;")},
+			"migrations/20240305090000_b.up.sql":   {Data: []byte("SELECT 1;")},
+			"migrations/20240305090000_b.down.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		findings, err := Lint(fsys, "migrations")
+		assert.Nil(t, err)
+		assert.Empty(t, findings)
+	})
+}
@@ -0,0 +1,172 @@
+package migratetest
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/migrations"
+	"github.com/litestack-hq/lgst-common/helpers/pgtest"
+)
+
+// NULL_TEXT stands for NULL values in the dump
+const NULL_TEXT = "<null>"
+
+// Catalog queries whose combined output describes the public schema. The
+// golang-migrate bookkeeping table is left out since it changes on every step.
+var schemaQueries = []string{
+	`SELECT table_name, column_name, data_type, is_nullable, COALESCE(column_default, '')
+	FROM information_schema.columns
+	WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+	ORDER BY table_name, column_name`,
+	`SELECT tablename, indexdef
+	FROM pg_indexes
+	WHERE schemaname = 'public' AND tablename <> 'schema_migrations'
+	ORDER BY tablename, indexname`,
+	`SELECT c.conrelid::regclass::text, c.conname, pg_get_constraintdef(c.oid)
+	FROM pg_constraint c JOIN pg_namespace n ON n.oid = c.connamespace
+	WHERE n.nspname = 'public' AND c.conrelid::regclass::text <> 'schema_migrations'
+	ORDER BY 1, 2`,
+	`SELECT t.typname, string_agg(e.enumlabel, ',' ORDER BY e.enumsortorder)
+	FROM pg_type t
+	JOIN pg_enum e ON e.enumtypid = t.oid
+	JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE n.nspname = 'public'
+	GROUP BY t.typname
+	ORDER BY t.typname`,
+	`SELECT table_name, view_definition
+	FROM information_schema.views
+	WHERE table_schema = 'public'
+	ORDER BY table_name`,
+	`SELECT sequence_name, data_type
+	FROM information_schema.sequences
+	WHERE sequence_schema = 'public'
+	ORDER BY sequence_name`,
+	`SELECT p.proname, pg_get_function_identity_arguments(p.oid), md5(p.prosrc)
+	FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE n.nspname = 'public'
+	ORDER BY 1, 2`,
+	`SELECT event_object_table, trigger_name, event_manipulation, action_statement
+	FROM information_schema.triggers
+	WHERE trigger_schema = 'public'
+	ORDER BY 1, 2, 3`,
+}
+
+// DumpSchema - Stable text description of the public schema of db, comparable
+// between two points of a migration history
+func DumpSchema(ctx context.Context, db *sqlx.DB) (string, error) {
+	dump := strings.Builder{}
+
+	for _, query := range schemaQueries {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return "", err
+		}
+
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return "", err
+		}
+
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			pointers := make([]any, len(columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				return "", err
+			}
+
+			// Catalog columns such as view_definition may be NULL
+			texts := make([]string, len(values))
+			for i, value := range values {
+				texts[i] = NULL_TEXT
+				if value.Valid {
+					texts[i] = value.String
+				}
+			}
+
+			dump.WriteString(strings.Join(texts, " | "))
+			dump.WriteString("\n")
+		}
+
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return "", err
+		}
+		rows.Close()
+
+		dump.WriteString("--\n")
+	}
+
+	return dump.String(), nil
+}
+
+// VerifyRoundTrip - Starts a throwaway Postgres with pgtest and, for every
+// migration in dir of fsys, runs it up, down and up again, failing t when the
+// down migration does not restore the schema exactly or the second up does
+// not reproduce the first one
+func VerifyRoundTrip(t testing.TB, fsys fs.FS, dir string) {
+	t.Helper()
+
+	ctx := context.Background()
+	pg := pgtest.Start(t, pgtest.Options{Database: "migratetest"})
+	db := pg.DB
+
+	m, err := migrations.NewFromFS(pg.URL, fsys, dir)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	defer m.Close()
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+
+	dump := func() string {
+		schema, err := DumpSchema(ctx, db)
+		if err != nil {
+			t.Fatalf("failed to dump schema: %v", err)
+		}
+		return schema
+	}
+
+	step := func(migration migrations.MigrationStatus, direction string, n int) {
+		if err := m.Steps(n); err != nil {
+			t.Fatalf("migration %d_%s failed going %s: %v", migration.Version, migration.Name, direction, err)
+		}
+	}
+
+	for _, migration := range statuses {
+		before := dump()
+
+		step(migration, "up", 1)
+		afterUp := dump()
+
+		step(migration, "down", -1)
+		if afterDown := dump(); afterDown != before {
+			t.Fatalf(
+				"down migration of %d_%s does not restore the schema\nbefore up:\n%s\nafter down:\n%s",
+				migration.Version, migration.Name, before, afterDown,
+			)
+		}
+
+		step(migration, "up", 1)
+		if afterRedo := dump(); afterRedo != afterUp {
+			t.Fatalf(
+				"%d_%s gives a different schema when run again\nfirst up:\n%s\nsecond up:\n%s",
+				migration.Version, migration.Name, afterUp, afterRedo,
+			)
+		}
+	}
+
+	t.Logf("verified %d migrations round trip", len(statuses))
+}
@@ -0,0 +1,76 @@
+package migratetest
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/docker/docker/client"
+	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/pgtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = fstest.MapFS{
+	"migrations/1_create_users.up.sql": {Data: []byte(`
+CREATE TABLE users (id SERIAL PRIMARY KEY, email TEXT NOT NULL UNIQUE, name TEXT);
+CREATE VIEW named_users AS SELECT id, name FROM users WHERE name IS NOT NULL;
+`)},
+	"migrations/1_create_users.down.sql": {Data: []byte("DROP VIEW named_users;\nDROP TABLE users;")},
+	"migrations/2_add_users_phonenumber.up.sql": {Data: []byte(`
+ALTER TABLE users ADD COLUMN phonenumber TEXT;
+CREATE INDEX users_phonenumber_idx ON users (phonenumber);
+`)},
+	"migrations/2_add_users_phonenumber.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN phonenumber;")},
+}
+
+func requireDocker(t *testing.T) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err == nil {
+		defer cli.Close()
+		_, err = cli.Ping(context.Background())
+	}
+
+	if err != nil {
+		t.Skipf("docker is not available: %v", err)
+	}
+}
+
+func TestDumpSchema(t *testing.T) {
+	requireDocker(t)
+
+	ctx := context.Background()
+	pg := pgtest.Start(t, pgtest.Options{Migrations: testMigrations, MigrationsDir: "migrations"})
+
+	schema, err := DumpSchema(ctx, pg.DB)
+	assert.Nil(t, err)
+	assert.Contains(t, schema, "users | phonenumber | text | YES")
+	assert.Contains(t, schema, "users_phonenumber_idx")
+	assert.Contains(t, schema, "named_users | ")
+	assert.NotContains(t, schema, "schema_migrations")
+
+	// information_schema hides the definition of views owned by others
+	_, err = pg.DB.Exec("CREATE ROLE migratetest_reader LOGIN PASSWORD 'reader'")
+	assert.Nil(t, err)
+	// Roles outlive the test database, reused containers would keep it
+	t.Cleanup(func() { pg.DB.Exec("DROP ROLE IF EXISTS migratetest_reader") })
+
+	readerUrl, err := url.Parse(pg.URL)
+	assert.Nil(t, err)
+	readerUrl.User = url.UserPassword("migratetest_reader", "reader")
+
+	reader, err := sqlx.Connect("postgres", readerUrl.String())
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	schema, err = DumpSchema(ctx, reader)
+	assert.Nil(t, err)
+	assert.Contains(t, schema, "named_users | "+NULL_TEXT)
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	requireDocker(t)
+
+	VerifyRoundTrip(t, testMigrations, "migrations")
+}
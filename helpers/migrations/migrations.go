@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+const SOURCE_NAME = "iofs"
+
+// Migrator - Migrations of one source applied to one database.
+// Every operation treats migrate.ErrNoChange as success.
+type Migrator struct {
+	m      *migrate.Migrate
+	source source.Driver
+}
+
+// MigrationStatus - One migration of the source and whether it is applied
+type MigrationStatus struct {
+	Version uint
+	Name    string
+	// Applied is false for a dirty migration, it did not complete
+	Applied bool
+	// Dirty is set on the current version when its migration failed half way
+	Dirty bool
+}
+
+// logger - Sends golang-migrate progress to slog
+type logger struct{}
+
+func (logger) Printf(format string, v ...any) {
+	slog.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (logger) Verbose() bool {
+	return false
+}
+
+// NewSource - Source driver reading the migrations stored in dir of fsys,
+// usually an embed.FS shipped with the service binary
+func NewSource(fsys fs.FS, dir string) (source.Driver, error) {
+	return iofs.New(fsys, dir)
+}
+
+// New - Migrator applying the migrations of src. The caller keeps owning
+// src, Close leaves it open.
+func New(dbUrl string, src source.Driver) (*Migrator, error) {
+	return newMigrator(dbUrl, borrowedSource{src})
+}
+
+func newMigrator(dbUrl string, src source.Driver) (*Migrator, error) {
+	m, err := migrate.NewWithSourceInstance(SOURCE_NAME, src, dbUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Log = logger{}
+
+	return &Migrator{m: m, source: src}, nil
+}
+
+// NewFromFS - Migrator for the migrations stored in dir of fsys, e.g.
+//
+//	//go:embed migrations
+//	var migrationsFS embed.FS
+//
+//	m, err := migrations.NewFromFS(cfg.DB_URL, migrationsFS, "migrations")
+func NewFromFS(dbUrl string, fsys fs.FS, dir string) (*Migrator, error) {
+	src, err := NewSource(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(dbUrl, src)
+}
+
+// RunFromFS - Applies every pending migration stored in dir of fsys
+func RunFromFS(dbUrl string, fsys fs.FS, dir string) error {
+	m, err := NewFromFS(dbUrl, fsys, dir)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	return m.Up()
+}
+
+// Up - Applies every pending migration
+func (m *Migrator) Up() error {
+	slog.Info("running migrations")
+	return ignoreNoChange(m.m.Up())
+}
+
+// Down - Reverts every applied migration
+func (m *Migrator) Down() error {
+	slog.Info("reverting migrations")
+	return ignoreNoChange(m.m.Down())
+}
+
+// Steps - Applies the next n migrations, or reverts the last -n when n is negative
+func (m *Migrator) Steps(n int) error {
+	slog.Info("migrating steps", slog.Int("steps", n))
+	return ignoreNoChange(m.m.Steps(n))
+}
+
+// Goto - Migrates up or down to version
+func (m *Migrator) Goto(version uint) error {
+	slog.Info("migrating to version", slog.Uint64("version", uint64(version)))
+	return ignoreNoChange(m.m.Migrate(version))
+}
+
+// Force - Sets the recorded version and clears the dirty flag without running
+// anything. -1 records that no migration is applied.
+func (m *Migrator) Force(version int) error {
+	slog.Warn("forcing migration version", slog.Int("version", version))
+	return m.m.Force(version)
+}
+
+// Version - Currently applied version, zero when no migration was ever applied
+func (m *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Status - Every migration of the source, in order, marked applied or pending
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := listMigrations(m.source)
+	if err != nil {
+		return nil, err
+	}
+
+	markApplied(statuses, version, dirty)
+
+	return statuses, nil
+}
+
+func (m *Migrator) Drop() error {
+	return m.m.Drop()
+}
+
+// borrowedSource - A source driver owned by the caller of New, which
+// golang-migrate must not close
+type borrowedSource struct {
+	source.Driver
+}
+
+func (borrowedSource) Close() error {
+	return nil
+}
+
+// Close - Releases the database connection, and the source when the Migrator
+// opened it itself
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+func listMigrations(src source.Driver) ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+
+	version, err := src.First()
+	for err == nil {
+		name := ""
+		body, identifier, readErr := src.ReadUp(version)
+		if readErr == nil {
+			body.Close()
+			name = identifier
+		} else if !errors.Is(readErr, os.ErrNotExist) {
+			return nil, readErr
+		}
+
+		statuses = append(statuses, MigrationStatus{Version: version, Name: name})
+		version, err = src.Next(version)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+func markApplied(statuses []MigrationStatus, version uint, dirty bool) {
+	for i := range statuses {
+		statuses[i].Dirty = dirty && statuses[i].Version == version
+		statuses[i].Applied = statuses[i].Version <= version && !statuses[i].Dirty
+	}
+}
@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"embed"
+	"io"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/migrations
+var testMigrations embed.FS
+
+func TestNewSource(t *testing.T) {
+	src, err := NewSource(testMigrations, "testdata/migrations")
+	assert.Nil(t, err)
+	defer src.Close()
+
+	first, err := src.First()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), first)
+
+	next, err := src.Next(first)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), next)
+
+	body, identifier, err := src.ReadUp(next)
+	assert.Nil(t, err)
+	defer body.Close()
+
+	contents, _ := io.ReadAll(body)
+	assert.Equal(t, "add_users_phonenumber", identifier)
+	assert.Contains(t, string(contents), "ADD COLUMN phonenumber")
+
+	_, err = NewSource(testMigrations, "testdata/missing")
+	assert.NotNil(t, err)
+}
+
+type closeRecorder struct {
+	source.Driver
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestBorrowedSource(t *testing.T) {
+	src, err := NewSource(testMigrations, "testdata/migrations")
+	assert.Nil(t, err)
+
+	recorder := &closeRecorder{Driver: src}
+	borrowed := borrowedSource{recorder}
+
+	assert.Nil(t, borrowed.Close())
+	assert.False(t, recorder.closed)
+
+	first, err := borrowed.First()
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), first)
+}
+
+func TestNewFromFSRejectsBadInput(t *testing.T) {
+	_, err := NewFromFS("postgres://localhost:5432/test", testMigrations, "testdata/missing")
+	assert.NotNil(t, err)
+
+	_, err = NewFromFS("unknown://localhost/test", testMigrations, "testdata/migrations")
+	assert.NotNil(t, err)
+}
+
+func TestListMigrations(t *testing.T) {
+	src, err := NewSource(testMigrations, "testdata/migrations")
+	assert.Nil(t, err)
+
+	statuses, err := listMigrations(src)
+	assert.Nil(t, err)
+	assert.Equal(t, []MigrationStatus{
+		{Version: 1, Name: "create_users"},
+		{Version: 2, Name: "add_users_phonenumber"},
+	}, statuses)
+
+	markApplied(statuses, 1, true)
+	assert.False(t, statuses[0].Applied)
+	assert.True(t, statuses[0].Dirty)
+	assert.False(t, statuses[1].Applied)
+
+	markApplied(statuses, 2, true)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+	assert.True(t, statuses[1].Dirty)
+
+	markApplied(statuses, 0, false)
+	assert.False(t, statuses[0].Applied)
+	assert.False(t, statuses[0].Dirty)
+}
@@ -0,0 +1,296 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/lib/pq"
+)
+
+const (
+	DEFAULT_LOCK_NAME    = "migrations"
+	DEFAULT_LOCK_TIMEOUT = time.Minute
+)
+
+var (
+	ErrDirty       = errors.New("database is in a dirty migration state")
+	ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+)
+
+type RunnerOpts struct {
+	// LockName identifies the advisory lock shared by every replica of a
+	// service, defaults to DEFAULT_LOCK_NAME
+	LockName string
+	// LockTimeout defaults to DEFAULT_LOCK_TIMEOUT
+	LockTimeout time.Duration
+	// DryRun prints the pending SQL to Out instead of applying it
+	DryRun bool
+	// Out defaults to os.Stdout
+	Out io.Writer
+}
+
+// Runner - Applies migrations at startup while holding a Postgres advisory
+// lock, so replicas starting together migrate one at a time
+type Runner struct {
+	dbUrl    string
+	source   source.Driver
+	migrator *Migrator
+	opts     RunnerOpts
+}
+
+// PendingMigration - Migration that Run would apply, with its SQL
+type PendingMigration struct {
+	Version uint
+	Name    string
+	SQL     string
+}
+
+// DirtyError - The previous run failed half way through Version. Fix the
+// schema by hand, then force Previous with Runner.Recover.
+type DirtyError struct {
+	Version  uint
+	Previous int
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf(
+		"%s: migration %d failed part way; repair the schema by hand, then recover to version %d and run the migrations again",
+		ErrDirty, e.Version, e.Previous,
+	)
+}
+
+func (e *DirtyError) Is(target error) bool {
+	return target == ErrDirty
+}
+
+func NewRunner(dbUrl string, src source.Driver, opts RunnerOpts) (*Runner, error) {
+	if opts.LockName == "" {
+		opts.LockName = DEFAULT_LOCK_NAME
+	}
+
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = DEFAULT_LOCK_TIMEOUT
+	}
+
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+
+	m, err := New(dbUrl, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{
+		dbUrl:    dbUrl,
+		source:   src,
+		migrator: m,
+		opts:     opts,
+	}, nil
+}
+
+// Run - Takes the lock, refuses to continue from a dirty state, then applies
+// or, in dry-run mode, prints the pending migrations
+func (r *Runner) Run(ctx context.Context) error {
+	return r.withLock(ctx, func() error {
+		if err := r.checkDirty(); err != nil {
+			return err
+		}
+
+		if r.opts.DryRun {
+			pending, err := r.Pending()
+			if err != nil {
+				return err
+			}
+			return writeDryRun(r.opts.Out, pending)
+		}
+
+		return r.migrator.Up()
+	})
+}
+
+// Pending - Migrations newer than the current version
+func (r *Runner) Pending() ([]PendingMigration, error) {
+	version, _, err := r.migrator.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingMigrations(r.source, version)
+}
+
+// Recover - When the database is dirty, asks confirm whether to force the
+// version before the failed migration and does so if it agrees. Does nothing
+// on a clean database.
+func (r *Runner) Recover(ctx context.Context, confirm func(dirty DirtyError) bool) error {
+	return r.withLock(ctx, func() error {
+		err := r.checkDirty()
+
+		var dirtyErr *DirtyError
+		if !errors.As(err, &dirtyErr) {
+			return err
+		}
+
+		if !confirm(*dirtyErr) {
+			return fmt.Errorf("recovery not confirmed: %w", dirtyErr)
+		}
+
+		slog.Warn(
+			"recovering from dirty migration state",
+			slog.Uint64("dirty-version", uint64(dirtyErr.Version)),
+			slog.Int("forced-version", dirtyErr.Previous),
+		)
+
+		return r.migrator.Force(dirtyErr.Previous)
+	})
+}
+
+func (r *Runner) Migrator() *Migrator {
+	return r.migrator
+}
+
+func (r *Runner) Close() error {
+	return r.migrator.Close()
+}
+
+func (r *Runner) checkDirty() error {
+	version, dirty, err := r.migrator.Version()
+	if err != nil || !dirty {
+		return err
+	}
+
+	previous, err := previousVersion(r.source, version)
+	if err != nil {
+		return err
+	}
+
+	return &DirtyError{Version: version, Previous: previous}
+}
+
+func (r *Runner) withLock(ctx context.Context, fn func() error) error {
+	db, err := sql.Open("postgres", r.dbUrl)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, r.opts.LockTimeout)
+	defer cancel()
+
+	// Session level advisory locks belong to a connection, so the lock and
+	// unlock must go through the same one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := lockKey(r.opts.LockName)
+	logger := slog.With(slog.String("lock", r.opts.LockName))
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%w %q: %w", ErrLockTimeout, r.opts.LockName, err)
+			}
+			return err
+		}
+
+		if acquired {
+			break
+		}
+
+		logger.Info("waiting for migration lock")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w %q", ErrLockTimeout, r.opts.LockName)
+		case <-time.After(time.Second):
+		}
+	}
+
+	logger.Info("acquired migration lock")
+
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			logger.Error("failed to release migration lock", slog.String("error", err.Error()))
+		}
+	}()
+
+	return fn()
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func previousVersion(src source.Driver, version uint) (int, error) {
+	previous, err := src.Prev(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(previous), nil
+}
+
+func pendingMigrations(src source.Driver, version uint) ([]PendingMigration, error) {
+	statuses, err := listMigrations(src)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []PendingMigration{}
+
+	for _, status := range statuses {
+		if status.Version <= version {
+			continue
+		}
+
+		body, identifier, err := src.ReadUp(status.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, PendingMigration{
+			Version: status.Version,
+			Name:    identifier,
+			SQL:     string(contents),
+		})
+	}
+
+	return pending, nil
+}
+
+func writeDryRun(out io.Writer, pending []PendingMigration) error {
+	if len(pending) == 0 {
+		_, err := fmt.Fprintln(out, "-- no pending migrations")
+		return err
+	}
+
+	for _, migration := range pending {
+		if _, err := fmt.Fprintf(out, "-- %d_%s.up.sql\n%s\n", migration.Version, migration.Name, migration.SQL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
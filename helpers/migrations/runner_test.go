@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, lockKey("users-service"), lockKey("users-service"))
+	assert.NotEqual(t, lockKey("users-service"), lockKey("billing-service"))
+}
+
+func TestPendingMigrations(t *testing.T) {
+	src, err := NewSource(testMigrations, "testdata/migrations")
+	assert.Nil(t, err)
+
+	pending, err := pendingMigrations(src, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, uint(2), pending[0].Version)
+	assert.Contains(t, pending[0].SQL, "ADD COLUMN phonenumber")
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, writeDryRun(out, pending))
+	assert.Contains(t, out.String(), "-- 2_add_users_phonenumber.up.sql\nALTER TABLE users")
+
+	pending, err = pendingMigrations(src, 2)
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	out.Reset()
+	assert.Nil(t, writeDryRun(out, pending))
+	assert.Equal(t, "-- no pending migrations\n", out.String())
+}
+
+func TestDirtyState(t *testing.T) {
+	src, err := NewSource(testMigrations, "testdata/migrations")
+	assert.Nil(t, err)
+
+	previous, err := previousVersion(src, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, previous)
+
+	previous, err = previousVersion(src, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, previous)
+
+	var dirtyErr error = &DirtyError{Version: 2, Previous: 1}
+	assert.ErrorIs(t, dirtyErr, ErrDirty)
+	assert.Contains(t, dirtyErr.Error(), "recover to version 1")
+}
@@ -0,0 +1,230 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/containers"
+	"github.com/litestack-hq/lgst-common/helpers/migrations"
+	"github.com/litestack-hq/lgst-common/helpers/utils"
+)
+
+const (
+	DEFAULT_USER          = "pgtest"
+	DEFAULT_PASSWORD      = "pgtest"
+	DEFAULT_DATABASE      = "pgtest"
+	DEFAULT_START_TIMEOUT = 3 * time.Minute
+)
+
+// TB - What Start needs from its caller. *testing.T, *testing.B and the
+// *Main wrapper for TestMain all satisfy it.
+type TB interface {
+	Helper()
+	Logf(format string, args ...any)
+	Fatalf(format string, args ...any)
+	Cleanup(fn func())
+}
+
+type Options struct {
+	User     string
+	Password string
+	Database string
+	// Migrations, when set, are applied from MigrationsDir before Start returns
+	Migrations    fs.FS
+	MigrationsDir string
+	// StartTimeout bounds pulling, starting, waiting and migrating,
+	// defaults to DEFAULT_START_TIMEOUT
+	StartTimeout time.Duration
+	// Reuse keeps the container running for the next run, see
+	// containers.ContainerSpec.Reuse. Rows written through Harness.DB
+	// survive, databases from NewDatabase do not.
+	Reuse bool
+}
+
+// Harness - A running Postgres container and a pool connected to it
+type Harness struct {
+	DB          *sqlx.DB
+	URL         string
+	ContainerID string
+	Container   *containers.Container
+	Docker      *client.Client
+	Options     Options
+	template    *template
+}
+
+// Start - Pulls the image, starts a Postgres container, waits for it, runs
+// the migrations and connects. The container is stopped by tb's cleanup,
+// which for a *testing.T also runs when the test panics.
+func Start(tb TB, opts Options) *Harness {
+	tb.Helper()
+
+	opts = opts.withDefaults()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.StartTimeout)
+	defer cancel()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		tb.Fatalf("pgtest: failed to create docker client: %v", err)
+	}
+	tb.Cleanup(func() { cli.Close() })
+
+	c, dbUrl, err := utils.StartDbContainer(ctx, cli, utils.DbConfig{
+		User:     opts.User,
+		Password: opts.Password,
+		Database: opts.Database,
+		Reuse:    opts.Reuse,
+	})
+	if err != nil {
+		tb.Fatalf("pgtest: failed to start database container: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		if err := c.Stop(context.Background()); err != nil {
+			tb.Logf("pgtest: failed to stop container %s: %v", c.ID, err)
+		}
+	})
+
+	if err := utils.WaitFor(ctx, utils.SQLProbe("postgres", dbUrl), utils.DEFAULT_BACKOFF_POLICY); err != nil {
+		tb.Fatalf("pgtest: database never became ready: %v", err)
+	}
+
+	if opts.Migrations != nil {
+		if err := migrations.RunFromFS(dbUrl, opts.Migrations, opts.MigrationsDir); err != nil {
+			tb.Fatalf("pgtest: failed to run migrations: %v", err)
+		}
+	}
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", dbUrl)
+	if err != nil {
+		tb.Fatalf("pgtest: failed to connect: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	h := &Harness{
+		DB:          db,
+		URL:         dbUrl,
+		ContainerID: c.ID,
+		Container:   c,
+		Docker:      cli,
+		Options:     opts,
+		template:    &template{},
+	}
+
+	tb.Cleanup(func() {
+		if err := h.dropTemplate(context.Background()); err != nil {
+			tb.Logf("pgtest: failed to drop template database: %v", err)
+		}
+	})
+
+	return h
+}
+
+func (o Options) withDefaults() Options {
+	if o.User == "" {
+		o.User = DEFAULT_USER
+	}
+
+	if o.Password == "" {
+		o.Password = DEFAULT_PASSWORD
+	}
+
+	if o.Database == "" {
+		o.Database = DEFAULT_DATABASE
+	}
+
+	if o.MigrationsDir == "" {
+		o.MigrationsDir = "."
+	}
+
+	if o.StartTimeout <= 0 {
+		o.StartTimeout = DEFAULT_START_TIMEOUT
+	}
+
+	return o
+}
+
+// Main - TB for package level harnesses started from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		main := pgtest.NewMain(m)
+//		pg = pgtest.Start(main, pgtest.Options{Migrations: migrationsFS})
+//		os.Exit(main.Run())
+//	}
+//
+// Cleanups run after the tests, on Fatalf and on SIGINT/SIGTERM. A panicking
+// test ends the process before TestMain regains control, so prefer a per-test
+// Start where a leaked container would matter.
+type Main struct {
+	m        *testing.M
+	mu       sync.Mutex
+	cleanups []func()
+	signals  chan os.Signal
+}
+
+func NewMain(m *testing.M) *Main {
+	main := &Main{
+		m:       m,
+		signals: make(chan os.Signal, 1),
+	}
+
+	signal.Notify(main.signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-main.signals; ok {
+			main.runCleanups()
+			os.Exit(1)
+		}
+	}()
+
+	return main
+}
+
+// Run - Runs the tests, then the cleanups, and returns the exit code
+func (m *Main) Run() int {
+	defer func() {
+		signal.Stop(m.signals)
+		close(m.signals)
+	}()
+	defer m.runCleanups()
+
+	return m.m.Run()
+}
+
+func (m *Main) Helper() {}
+
+func (m *Main) Logf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func (m *Main) Fatalf(format string, args ...any) {
+	m.Logf(format, args...)
+	m.runCleanups()
+	os.Exit(1)
+}
+
+func (m *Main) Cleanup(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanups = append(m.cleanups, fn)
+}
+
+// runCleanups - Last registered first, like testing.T
+func (m *Main) runCleanups() {
+	m.mu.Lock()
+	cleanups := m.cleanups
+	m.cleanups = nil
+	m.mu.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
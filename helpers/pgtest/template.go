@@ -0,0 +1,173 @@
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/litestack-hq/lgst-common/helpers/migrations"
+)
+
+const (
+	MAINTENANCE_DATABASE = "postgres"
+	TEMPLATE_SUFFIX      = "_template"
+)
+
+// Database - A throwaway database cloned from the harness template
+type Database struct {
+	*sqlx.DB
+	Name string
+	URL  string
+}
+
+// template - Lazily created, migrated once, then only ever cloned
+type template struct {
+	once    sync.Once
+	err     error
+	name    string
+	admin   *sqlx.DB
+	counter atomic.Uint64
+	prefix  string
+}
+
+// NewDatabase - Creates a database from the migrated template, connects to it
+// and drops it when tb is done. Every call gets a database of its own, so
+// tests using it can call t.Parallel().
+func (h *Harness) NewDatabase(tb TB) *Database {
+	tb.Helper()
+
+	ctx := context.Background()
+
+	if err := h.prepareTemplate(ctx); err != nil {
+		tb.Fatalf("pgtest: failed to prepare template database: %v", err)
+	}
+
+	name := fmt.Sprintf("%s_%d", h.template.prefix, h.template.counter.Add(1))
+
+	query := fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(h.template.name))
+	if _, err := h.template.admin.ExecContext(ctx, query); err != nil {
+		tb.Fatalf("pgtest: failed to create database %s: %v", name, err)
+	}
+
+	tb.Cleanup(func() {
+		if err := dropDatabase(context.Background(), h.template.admin, name); err != nil {
+			tb.Logf("pgtest: failed to drop database %s: %v", name, err)
+		}
+	})
+
+	dbUrl, err := withDatabase(h.URL, name)
+	if err != nil {
+		tb.Fatalf("pgtest: %v", err)
+	}
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", dbUrl)
+	if err != nil {
+		tb.Fatalf("pgtest: failed to connect to %s: %v", name, err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	return &Database{DB: db, Name: name, URL: dbUrl}
+}
+
+func (h *Harness) prepareTemplate(ctx context.Context) error {
+	h.template.once.Do(func() {
+		h.template.err = h.createTemplate(ctx)
+	})
+	return h.template.err
+}
+
+func (h *Harness) createTemplate(ctx context.Context) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	h.template.prefix = h.Options.Database + "_" + hex.EncodeToString(suffix)
+
+	// Named per harness, a reused container may be shared by several test
+	// binaries at once
+	h.template.name = h.template.prefix + TEMPLATE_SUFFIX
+
+	adminUrl, err := withDatabase(h.URL, MAINTENANCE_DATABASE)
+	if err != nil {
+		return err
+	}
+
+	admin, err := sqlx.ConnectContext(ctx, "postgres", adminUrl)
+	if err != nil {
+		return err
+	}
+	h.template.admin = admin
+
+	if _, err := admin.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(h.template.name))); err != nil {
+		return err
+	}
+
+	if h.Options.Migrations != nil {
+		templateUrl, err := withDatabase(h.URL, h.template.name)
+		if err != nil {
+			return err
+		}
+
+		if err := migrations.RunFromFS(templateUrl, h.Options.Migrations, h.Options.MigrationsDir); err != nil {
+			return err
+		}
+	}
+
+	// Cloning fails while anyone is connected to the template, so nobody may
+	_, err = admin.ExecContext(ctx, fmt.Sprintf(
+		"ALTER DATABASE %s WITH IS_TEMPLATE true ALLOW_CONNECTIONS false",
+		pq.QuoteIdentifier(h.template.name),
+	))
+
+	return err
+}
+
+// dropTemplate - Drops the template if it was created, so reused containers
+// do not pile them up, and closes the maintenance connection
+func (h *Harness) dropTemplate(ctx context.Context) error {
+	admin := h.template.admin
+	if admin == nil {
+		return nil
+	}
+	defer admin.Close()
+
+	// Template databases cannot be dropped
+	query := fmt.Sprintf("ALTER DATABASE %s WITH IS_TEMPLATE false", pq.QuoteIdentifier(h.template.name))
+	if _, err := admin.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return dropDatabase(ctx, admin, h.template.name)
+}
+
+// dropDatabase - Ends the connections a test may have leaked, then drops
+// name. DROP DATABASE WITH (FORCE) would do both but needs PostgreSQL 13.
+func dropDatabase(ctx context.Context, admin *sqlx.DB, name string) error {
+	_, err := admin.ExecContext(ctx,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()",
+		name,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = admin.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(name)))
+	return err
+}
+
+func withDatabase(dbUrl string, name string) (string, error) {
+	u, err := url.Parse(dbUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid database url: %w", err)
+	}
+
+	u.Path = "/" + name
+
+	return u.String(), nil
+}
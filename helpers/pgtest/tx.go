@@ -0,0 +1,35 @@
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Tx - Begins a transaction that is rolled back when tb is done, whatever the
+// test did. Pass it wherever a db.Executor is expected; db.RunInTx turns
+// transactions started inside it into savepoints, so nothing is ever committed.
+func Tx(tb TB, db *sqlx.DB) *sqlx.Tx {
+	tb.Helper()
+
+	tx, err := db.BeginTxx(context.Background(), nil)
+	if err != nil {
+		tb.Fatalf("pgtest: failed to begin transaction: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			tb.Logf("pgtest: failed to roll back transaction: %v", err)
+		}
+	})
+
+	return tx
+}
+
+// Tx - Transaction on the harness database, see Tx
+func (h *Harness) Tx(tb TB) *sqlx.Tx {
+	tb.Helper()
+	return Tx(tb, h.DB)
+}
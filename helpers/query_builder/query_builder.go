@@ -1,6 +1,7 @@
 package query_builder
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log/slog"
@@ -238,3 +239,17 @@ func BuildUpdateQueryFromModel(table string, model any, id any, skipConflicting
 
 	return buildUpdateQuery(table, inputValues, id, skipConflicting)
 }
+
+// InsertModel - Runs the query built by BuildInsertQueryFromModel on ex and
+// scans the inserted row into dest
+func InsertModel(ctx context.Context, ex Getter, table string, model any, dest any, skipConflicting bool) error {
+	query, args := BuildInsertQueryFromModel(table, model, skipConflicting)
+	return ex.GetContext(ctx, dest, query, args...)
+}
+
+// UpdateModel - Runs the query built by BuildUpdateQueryFromModel on ex and
+// scans the updated row into dest
+func UpdateModel(ctx context.Context, ex Getter, table string, model any, id any, dest any, skipConflicting bool) error {
+	query, args := BuildUpdateQueryFromModel(table, model, id, skipConflicting)
+	return ex.GetContext(ctx, dest, query, args...)
+}
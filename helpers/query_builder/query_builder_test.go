@@ -1,6 +1,7 @@
 package query_builder
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -154,3 +155,34 @@ func TestBuildUpdateQuery(t *testing.T) {
 		assert.Equal(t, 5, len(values))
 	})
 }
+
+type recordingGetter struct {
+	query string
+	args  []any
+}
+
+func (g *recordingGetter) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	g.query = query
+	g.args = args
+	return nil
+}
+
+func TestInsertAndUpdateModel(t *testing.T) {
+	input := struct {
+		Id   string `db:"id"`
+		Name string `db:"name"`
+	}{
+		Id:   "12345",
+		Name: "John",
+	}
+
+	getter := &recordingGetter{}
+
+	assert.Nil(t, InsertModel(context.Background(), getter, "users", input, &input, false))
+	assert.Regexp(t, `^INSERT INTO users \(.*\) VALUES \(\$1, \$2\) RETURNING \*$`, getter.query)
+	assert.Equal(t, 2, len(getter.args))
+
+	assert.Nil(t, UpdateModel(context.Background(), getter, "users", input, input.Id, &input, false))
+	assert.Regexp(t, `^UPDATE users SET .* WHERE id = \$3 RETURNING \*$`, getter.query)
+	assert.Equal(t, 3, len(getter.args))
+}
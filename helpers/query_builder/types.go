@@ -1,5 +1,13 @@
 package query_builder
 
+import "context"
+
+// Getter - Runs a query and scans its single row into dest. *sqlx.DB, *sqlx.Tx
+// and every db.Executor satisfy it.
+type Getter interface {
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
 type TableSortOrder string
 
 func (value *TableSortOrder) IsValid() bool {
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// MAX_RESERVE_ATTEMPTS bounds how often Reserve asks the OS again when it
+// hands out a port that is still registered
+const MAX_RESERVE_ATTEMPTS = 10
+
+var ErrPortReleased = errors.New("port reservation already released")
+
+// PortRegistry - Ports handed out to servers started in this process. A port
+// stays registered until released, even after its listener is taken and
+// closed, so two callers never get the same one.
+type PortRegistry struct {
+	mu       sync.Mutex
+	reserved map[int]*PortReservation
+}
+
+// PortReservation - A port held by an open listener until Release
+type PortReservation struct {
+	Port     int
+	mu       sync.Mutex
+	listener net.Listener
+	released bool
+	registry *PortRegistry
+}
+
+var defaultPortRegistry = NewPortRegistry()
+
+func NewPortRegistry() *PortRegistry {
+	return &PortRegistry{reserved: map[int]*PortReservation{}}
+}
+
+// ReservePort - Reserves a loopback port in the process wide registry
+func ReservePort() (*PortReservation, error) {
+	return defaultPortRegistry.Reserve()
+}
+
+// Reserve - Listens on a free loopback port and registers it
+func (r *PortRegistry) Reserve() (*PortReservation, error) {
+	var stale []net.Listener
+	defer func() {
+		for _, listener := range stale {
+			listener.Close()
+		}
+	}()
+
+	for attempt := 0; attempt < MAX_RESERVE_ATTEMPTS; attempt++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		r.mu.Lock()
+		if _, taken := r.reserved[port]; taken {
+			r.mu.Unlock()
+			// Held until we are done so the OS moves on to another port
+			stale = append(stale, listener)
+			continue
+		}
+
+		reservation := &PortReservation{Port: port, listener: listener, registry: r}
+		r.reserved[port] = reservation
+		r.mu.Unlock()
+
+		return reservation, nil
+	}
+
+	return nil, fmt.Errorf("no unregistered port after %d attempts", MAX_RESERVE_ATTEMPTS)
+}
+
+// Reserved - Whether port is currently registered
+func (r *PortRegistry) Reserved(port int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.reserved[port]
+	return ok
+}
+
+// Listener - Hands the open listener over, e.g. to http.Server.Serve, which
+// avoids rebinding the port altogether. The caller closes it, the port stays
+// registered until Release.
+func (p *PortReservation) Listener() (net.Listener, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.released {
+		return nil, ErrPortReleased
+	}
+
+	if p.listener == nil {
+		return nil, errors.New("listener already taken")
+	}
+
+	listener := p.listener
+	p.listener = nil
+
+	return listener, nil
+}
+
+// Addr - host:port of the reservation
+func (p *PortReservation) Addr() string {
+	return fmt.Sprintf("127.0.0.1:%d", p.Port)
+}
+
+// Release - Closes the listener unless it was taken and unregisters the port.
+// Safe to call more than once.
+func (p *PortReservation) Release() error {
+	p.mu.Lock()
+	if p.released {
+		p.mu.Unlock()
+		return nil
+	}
+	p.released = true
+
+	listener := p.listener
+	p.listener = nil
+	p.mu.Unlock()
+
+	p.registry.mu.Lock()
+	delete(p.registry.reserved, p.Port)
+	p.registry.mu.Unlock()
+
+	if listener != nil {
+		return listener.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservePort(t *testing.T) {
+	registry := NewPortRegistry()
+
+	reservation, err := registry.Reserve()
+	assert.Nil(t, err)
+	assert.True(t, registry.Reserved(reservation.Port))
+
+	// Held by the reservation, nobody else can bind it
+	_, err = net.Listen("tcp", reservation.Addr())
+	assert.NotNil(t, err)
+
+	assert.Nil(t, reservation.Release())
+	assert.False(t, registry.Reserved(reservation.Port))
+	assert.Nil(t, reservation.Release())
+
+	listener, err := net.Listen("tcp", reservation.Addr())
+	assert.Nil(t, err)
+	listener.Close()
+
+	_, err = reservation.Listener()
+	assert.ErrorIs(t, err, ErrPortReleased)
+}
+
+func TestReservePortListener(t *testing.T) {
+	reservation, err := ReservePort()
+	assert.Nil(t, err)
+	defer reservation.Release()
+
+	listener, err := reservation.Listener()
+	assert.Nil(t, err)
+
+	_, err = reservation.Listener()
+	assert.NotNil(t, err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + reservation.Addr())
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	// Closing the taken listener keeps the port registered until Release
+	server.Close()
+	assert.True(t, defaultPortRegistry.Reserved(reservation.Port))
+}
+
+func TestReservePortConcurrent(t *testing.T) {
+	registry := NewPortRegistry()
+
+	var mu sync.Mutex
+	seen := map[int]bool{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reservation, err := registry.Reserve()
+			assert.Nil(t, err)
+
+			mu.Lock()
+			assert.False(t, seen[reservation.Port])
+			seen[reservation.Port] = true
+			mu.Unlock()
+
+			// Taken and closed, as a server shutting down early would
+			listener, _ := reservation.Listener()
+			listener.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 20)
+}
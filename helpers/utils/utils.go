@@ -3,26 +3,21 @@ package utils
 import (
 	"context"
 	"errors"
-	"fmt"
-	"io"
 	"net"
-	"os"
-	"runtime"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"log/slog"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
-	"github.com/jmoiron/sqlx"
+	"github.com/litestack-hq/lgst-common/helpers/containers"
+	"github.com/litestack-hq/lgst-common/helpers/migrations"
 	"github.com/nyaruka/phonenumbers"
 
 	emailNormalizer "github.com/dimuska139/go-email-normalizer"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
@@ -30,10 +25,43 @@ import (
 
 const DEFAULT_PHONENUMBER_COUNTRY = "NG"
 
+const (
+	POSTGRES_IMAGE       = "postgres"
+	POSTGIS_IMAGE        = "postgis/postgis"
+	TIMESCALEDB_IMAGE    = "timescale/timescaledb"
+	DEFAULT_POSTGRES_TAG = "14"
+
+	POSTGRES_PORT     = "5432/tcp"
+	POSTGRES_DATA_DIR = "/var/lib/postgresql/data"
+	POSTGRES_INIT_DIR = "/docker-entrypoint-initdb.d"
+)
+
 type DbConfig struct {
 	User     string
 	Password string
 	Database string
+	// Image defaults to POSTGRES_IMAGE. POSTGIS_IMAGE and TIMESCALEDB_IMAGE
+	// work too, with a matching Tag such as "14-3.4" or "latest-pg14".
+	Image string
+	// Tag defaults to DEFAULT_POSTGRES_TAG
+	Tag string
+	// SkipPullIfPresent only pulls when the image is not available locally
+	SkipPullIfPresent bool
+	// ServerFlags are passed to postgres as `-c key=value`, e.g.
+	// {"fsync": "off", "shared_buffers": "256MB"}
+	ServerFlags map[string]string
+	// InitScripts are copied to POSTGRES_INIT_DIR before the first start,
+	// keyed by file name. The image runs *.sql and *.sh files in name order.
+	InitScripts map[string]string
+	// Tmpfs keeps the data directory in memory, faster but lost on stop
+	Tmpfs bool
+	// Labels are added to the container next to containers.LABEL_MANAGED
+	Labels map[string]string
+	// HostIP the port is published on, defaults to 127.0.0.1
+	HostIP string
+	// Reuse picks up a container started with the same config by an earlier
+	// run instead of starting a new one, see containers.ContainerSpec.Reuse
+	Reuse bool
 }
 
 type NormalizePhonenumberOpts struct {
@@ -61,81 +89,54 @@ func NormalizeEmail(email string) string {
 }
 
 func DropMigrations(dbUrl string, source source.Driver) error {
-	m, err := migrate.NewWithSourceInstance("iofs", source, dbUrl)
-
+	m, err := migrations.New(dbUrl, source)
 	if err != nil {
 		return err
 	}
+	defer m.Close()
 
-	if err := m.Drop(); err != nil {
-		return err
-	}
-
-	return nil
+	return m.Drop()
 }
 
+// RunMigrations - Applies every pending migration, see migrations.Migrator
+// for the rest of the lifecycle
 func RunMigrations(dbUrl string, source source.Driver) error {
-	m, err := migrate.NewWithSourceInstance("iofs", source, dbUrl)
-
+	m, err := migrations.New(dbUrl, source)
 	if err != nil {
 		return err
 	}
+	defer m.Close()
 
-	slog.Info("running migrations")
-
-	if err := m.Up(); err != nil {
-		return err
-	}
-
-	return nil
+	return m.Up()
 }
 
+// WaitForDb - Waits up to 30 seconds for the database to accept connections
+//
+// Deprecated: Use WaitFor with SQLProbe, which takes a context and backs off exponentially.
 func WaitForDb(dbUrl string) error {
-	db, err := sqlx.Open("postgres", dbUrl)
-
-	if err != nil {
-		return err
-	}
-
-	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 
 	slog.Info("waiting for database")
 
-	for timeout := time.After(time.Second * 30); ; {
-		select {
-		case <-timeout:
-			return errors.New("database connection timed out")
-		default:
-			if err := db.Ping(); err != nil {
-				slog.Info("waiting...")
-				time.Sleep(time.Millisecond * 500)
-				continue
-			}
-			slog.Info("database connected")
-			return nil
-		}
-	}
+	return WaitFor(ctx, SQLProbe("postgres", dbUrl), DEFAULT_BACKOFF_POLICY)
 }
 
+// PullImage - See containers.PullImage
 func PullImage(ctx context.Context, cli *client.Client, imageName string) error {
-	slog.Info("pulling docker image", slog.String("image-name", imageName))
-	out, err := cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	io.Copy(os.Stdout, out)
-	return nil
+	return containers.PullImage(ctx, cli, imageName)
 }
 
+// StopContainer - See containers.StopContainer
 func StopContainer(ctx context.Context, cli *client.Client, id string) error {
-	timeOut := int(30 * time.Second)
-	stopOptions := container.StopOptions{
-		Timeout: &timeOut,
-	}
-	return cli.ContainerStop(ctx, id, stopOptions)
+	return containers.StopContainer(ctx, cli, id)
 }
 
+// GetFreePort - A port that was free when the call returned
+//
+// Deprecated: The port is released before it is used, so parallel callers can
+// get the same one. Let Docker pick container ports, and use ReservePort for
+// servers started in process.
 func GetFreePort() (int, error) {
 	tcpAddress, err := net.ResolveTCPAddr("tcp", "localhost:0")
 	if err == nil {
@@ -147,72 +148,110 @@ func GetFreePort() (int, error) {
 	return 0, err
 }
 
-func CreateDbContainer(ctx context.Context, cli *client.Client, config DbConfig) (string, string, error) {
-	imageName := "postgres:14"
+// PostgresSpec - Container spec CreateDbContainer starts for config
+func PostgresSpec(config DbConfig) containers.ContainerSpec {
+	config = config.withDefaults()
+
+	spec := containers.ContainerSpec{
+		Image: config.Image + ":" + config.Tag,
+		Cmd:   postgresCommand(config.ServerFlags),
+		Env: map[string]string{
+			"POSTGRES_USER":     config.User,
+			"POSTGRES_PASSWORD": config.Password,
+			"POSTGRES_DB":       config.Database,
+		},
+		Ports:             []string{POSTGRES_PORT},
+		HostIP:            config.HostIP,
+		Labels:            config.Labels,
+		SkipPullIfPresent: config.SkipPullIfPresent,
+		Reuse:             config.Reuse,
+		Files:             map[string]string{},
+		// The entrypoint runs a temporary server for initdb before the real one
+		WaitingFor: containers.ForLog("database system is ready to accept connections").WithOccurrences(2),
+	}
 
-	if err := PullImage(ctx, cli, imageName); err != nil {
-		return "", "", err
+	for name, script := range config.InitScripts {
+		spec.Files[path.Join(POSTGRES_INIT_DIR, name)] = script
 	}
 
-	port, err := GetFreePort()
+	if config.Tmpfs {
+		spec.Tmpfs = map[string]string{POSTGRES_DATA_DIR: "rw"}
+	}
+
+	return spec
+}
+
+func CreateDbContainer(ctx context.Context, cli *client.Client, config DbConfig) (string, string, error) {
+	c, dbUrl, err := StartDbContainer(ctx, cli, config)
 	if err != nil {
 		return "", "", err
 	}
 
-	resp, err := cli.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image: imageName,
-			Env: []string{
-				"POSTGRES_USER=" + config.User,
-				"POSTGRES_PASSWORD=" + config.Password,
-				"POSTGRES_DB=" + config.Database,
-				"listen_addresses = '*'",
-			},
-			ExposedPorts: nat.PortSet{
-				"5432/tcp": struct{}{},
-			},
-		},
-		&container.HostConfig{
-			AutoRemove: true,
-			PortBindings: nat.PortMap{
-				"5432/tcp": []nat.PortBinding{
-					{
-						HostIP:   "0.0.0.0",
-						HostPort: fmt.Sprint(port),
-					},
-				},
-			},
-		},
-		nil, nil, "",
-	)
+	return dbUrl, c.ID, nil
+}
+
+// StartDbContainer - Like CreateDbContainer, but returns the container so a
+// reused one is left running by its Stop
+func StartDbContainer(ctx context.Context, cli *client.Client, config DbConfig) (*containers.Container, string, error) {
+	// Docker picks the host port, Connection reads it back from inspect
+	c, err := containers.Start(ctx, cli, PostgresSpec(config))
 	if err != nil {
-		return "", "", err
+		return nil, "", err
+	}
+
+	conn, err := c.Connection(ctx, POSTGRES_PORT)
+	if err != nil {
+		return nil, "", errors.Join(err, c.Stop(context.Background()))
 	}
 
-	dbHost := "0.0.0.0"
+	return c, PostgresURL(conn, config), nil
+}
 
-	if linuxRunningOnDockerDesktop(ctx, cli) {
-		dbHost = "gateway.docker.internal"
+// PostgresURL - Connection string for the database of config at conn
+func PostgresURL(conn containers.ConnectionInfo, config DbConfig) string {
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     conn.Address(),
+		Path:     "/" + config.Database,
+		RawQuery: "sslmode=disable",
 	}
 
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return "", "", err
+	return u.String()
+}
+
+func (c DbConfig) withDefaults() DbConfig {
+	if c.Image == "" {
+		c.Image = POSTGRES_IMAGE
 	}
 
-	dbUrl := fmt.Sprintf(
-		"postgresql://%s:%s@%s:%d/%s?sslmode=disable",
-		config.User,
-		config.Password,
-		dbHost,
-		port,
-		config.Database,
-	)
+	if c.Tag == "" {
+		c.Tag = DEFAULT_POSTGRES_TAG
+	}
+
+	if c.HostIP == "" {
+		c.HostIP = "127.0.0.1"
+	}
 
-	return dbUrl, resp.ID, nil
+	return c
 }
 
-func linuxRunningOnDockerDesktop(ctx context.Context, dockerClient *client.Client) bool {
-	info, _ := dockerClient.Info(ctx)
-	return info.Name == "docker-desktop" && runtime.GOOS == "linux"
+// postgresCommand - Container command applying flags, nil keeps the image default
+func postgresCommand(flags map[string]string) []string {
+	if len(flags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cmd := []string{"postgres"}
+	for _, key := range keys {
+		cmd = append(cmd, "-c", key+"="+flags[key])
+	}
+
+	return cmd
 }
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Probe - A named readiness check, nil from Check means ready
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// BackoffPolicy - Jittered exponential backoff between probe attempts.
+// Zero fields fall back to DEFAULT_BACKOFF_POLICY.
+type BackoffPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter spreads each interval by up to ±Jitter of its length, between 0 and 1
+	Jitter float64
+}
+
+var DEFAULT_BACKOFF_POLICY = BackoffPolicy{
+	InitialInterval: 100 * time.Millisecond,
+	MaxInterval:     5 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// WaitFor - Runs probe until it succeeds or ctx is done, sleeping between
+// attempts according to policy
+func WaitFor(ctx context.Context, probe Probe, policy BackoffPolicy) error {
+	policy = policy.withDefaults()
+	logger := slog.With(slog.String("probe", probe.Name))
+
+	for attempt := 1; ; attempt++ {
+		err := probe.Check(ctx)
+		if err == nil {
+			logger.Info("dependency ready", slog.Int("attempt", attempt))
+			return nil
+		}
+
+		wait := policy.Interval(attempt)
+		logger.Info(
+			"waiting for dependency",
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", wait),
+			slog.String("error", err.Error()),
+		)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s not ready after %d attempts: %w", probe.Name, attempt, errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+	}
+}
+
+// Interval - How long to wait after the given attempt, counting from 1
+func (p BackoffPolicy) Interval(attempt int) time.Duration {
+	p = p.withDefaults()
+
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		interval += interval * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if interval > float64(p.MaxInterval) || math.IsInf(interval, 0) {
+		interval = float64(p.MaxInterval)
+	}
+
+	return time.Duration(interval)
+}
+
+func (p BackoffPolicy) withDefaults() BackoffPolicy {
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = DEFAULT_BACKOFF_POLICY.InitialInterval
+	}
+
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = DEFAULT_BACKOFF_POLICY.MaxInterval
+	}
+
+	if p.Multiplier < 1 {
+		p.Multiplier = DEFAULT_BACKOFF_POLICY.Multiplier
+	}
+
+	p.Jitter = math.Min(math.Max(p.Jitter, 0), 1)
+
+	return p
+}
+
+// SQLProbe - Opens a connection with the given driver and pings it
+func SQLProbe(driverName string, dsn string) Probe {
+	return Probe{
+		Name: driverName,
+		Check: func(ctx context.Context) error {
+			db, err := sql.Open(driverName, dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			return db.PingContext(ctx)
+		},
+	}
+}
+
+// DBProbe - Pings an existing pool
+func DBProbe(name string, db *sql.DB) Probe {
+	return Probe{
+		Name:  name,
+		Check: db.PingContext,
+	}
+}
+
+// TCPProbe - Succeeds once address accepts TCP connections
+func TCPProbe(address string) Probe {
+	return Probe{
+		Name: "tcp://" + address,
+		Check: func(ctx context.Context) error {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// HTTPProbe - Succeeds once a GET on url answers 200 OK
+func HTTPProbe(url string) Probe {
+	return Probe{
+		Name: url,
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("unexpected status %s", resp.Status)
+			}
+
+			return nil
+		},
+	}
+}
+
+// FuncProbe - Wraps a custom check
+func FuncProbe(name string, check func(ctx context.Context) error) Probe {
+	return Probe{
+		Name:  name,
+		Check: check,
+	}
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fastBackoff = BackoffPolicy{
+	InitialInterval: time.Millisecond,
+	MaxInterval:     5 * time.Millisecond,
+}
+
+func TestBackoffPolicyInterval(t *testing.T) {
+	policy := BackoffPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Interval(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Interval(2))
+	assert.Equal(t, 800*time.Millisecond, policy.Interval(4))
+	assert.Equal(t, time.Second, policy.Interval(5))
+	assert.Equal(t, time.Second, policy.Interval(5000))
+
+	policy.Jitter = 0.5
+	for attempt := 1; attempt < 50; attempt++ {
+		interval := policy.Interval(attempt)
+		assert.GreaterOrEqual(t, interval, 50*time.Millisecond)
+		assert.LessOrEqual(t, interval, time.Second)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	t.Run("Retries until the probe succeeds", func(t *testing.T) {
+		attempts := 0
+		probe := FuncProbe("flaky", func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		})
+
+		assert.Nil(t, WaitFor(context.Background(), probe, fastBackoff))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Gives up when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		probeErr := errors.New("still down")
+		err := WaitFor(ctx, FuncProbe("down", func(ctx context.Context) error { return probeErr }), fastBackoff)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, err, probeErr)
+	})
+}
+
+func TestProbes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TCP", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		address := listener.Addr().String()
+		assert.Nil(t, TCPProbe(address).Check(ctx))
+
+		listener.Close()
+		assert.NotNil(t, TCPProbe(address).Check(ctx))
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		healthy := atomic.Bool{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		assert.NotNil(t, HTTPProbe(server.URL).Check(ctx))
+
+		healthy.Store(true)
+		assert.Nil(t, HTTPProbe(server.URL).Check(ctx))
+	})
+}